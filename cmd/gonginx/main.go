@@ -2,28 +2,117 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"os"
 
 	_ "github.com/bingoohuang/godaemon/autoload"
 	_ "github.com/bingoohuang/golog/pkg/autoload"
 	"github.com/bingoohuang/gonginx/directive"
 	"github.com/bingoohuang/gonginx/nginxconf"
+	"github.com/bingoohuang/gonginx/util"
 	"github.com/bingoohuang/gou/file"
 )
 
-var configFile string
+var (
+	configFile string
+	signalName string
+)
+
+// version is set by go build -ldflags "-X main.version=...".
+var version = "dev"
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "match" {
+		match(os.Args[2:])
+		return
+	}
+
 	flag.StringVar(&configFile, "c", "conf/nginx.conf", "config file")
+	flag.StringVar(&signalName, "s", "", "send signal to the running process: stop, quit, reopen, reload, upgrade")
 	flag.Parse()
 
+	mainConf, servers, source, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if signalName != "" {
+		if err := sendSignal(mainConf.Pid, signalName); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	setupErrorLog(mainConf)
+
+	if err := writePid(mainConf.Pid); err != nil {
+		log.Fatalf("failed to write pid file %s: %v", mainConf.Pid, err)
+	}
+
+	defer removePid(mainConf.Pid)
+
+	runningServers := nginxconf.NewRunningServers()
+	for _, server := range servers {
+		runningServers.Register(server)
+	}
+
+	err = runningServers.Start()
+
+	reloads := make(chan chan error)
+	admin := startAdmin(mainConf, source, runningServers, reloads)
+
+	// the old process keeps serving on upgrade, unless all the listeners are served by the current one.
+	if err == nil {
+		notifyUpgradeParent()
+	} else if ppid := nginxconf.UpgradeParent(); ppid > 0 {
+		util.Errorf("not all listeners are served, process %d is not asked to quit: %v", ppid, err)
+	}
+	sdNotify("READY=1")
+
+	waitSignal(mainConf, runningServers, admin, reloads)
+	_ = admin.Close()
+	directive.FlushLogs()
+}
+
+// match explains which server and location serve the URL, like gonginx match -c conf http://host:port/path.
+func match(args []string) {
+	f := flag.NewFlagSet("match", flag.ExitOnError)
+	f.StringVar(&configFile, "c", "conf/nginx.conf", "config file")
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "Usage: %s match [-c config] URL\n", os.Args[0])
+		f.PrintDefaults()
+	}
+	_ = f.Parse(args)
+
+	if f.NArg() != 1 {
+		f.Usage()
+		os.Exit(2)
+	}
+
+	_, servers, _, err := loadConfig()
+	if err == nil {
+		err = nginxconf.ExplainMatch(os.Stdout, servers, f.Arg(0))
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// loadConfig loads the config file, and returns its source too.
+func loadConfig() (nginxconf.NginxMain, []nginxconf.NginxServer, []byte, error) {
 	if err := file.SingleFileExists(configFile); err != nil {
-		log.Fatalf("failed to find config file%s: %v", configFile, err)
+		return nginxconf.NginxMain{}, nil, nil, fmt.Errorf("failed to find config file%s: %w", configFile, err)
 	}
 
-	conf, err := nginxconf.Parse(file.ReadBytes(configFile))
+	source := file.ReadBytes(configFile)
+
+	conf, err := nginxconf.Parse(source)
 	if err != nil {
-		log.Fatalf("failed to pare config file%s: %v", configFile, err)
+		return nginxconf.NginxMain{}, nil, nil, fmt.Errorf("failed to pare config file%s: %w", configFile, err)
 	}
 
 	servers := conf.ParseServers()
@@ -36,11 +125,41 @@ func main() {
 		})
 	}
 
-	runningServers := nginxconf.NewRunningServers()
-	for _, server := range servers {
-		runningServers.Register(server)
+	return conf.ParseMain(), servers, source, nil
+}
+
+// startAdmin starts the admin API if admin_listen is configured,
+// its reloads are handled in the signal loop, like the HUP signal.
+func startAdmin(mainConf nginxconf.NginxMain, source []byte,
+	runningServers *nginxconf.RunningServers, reloads chan chan error) *nginxconf.Admin {
+	admin := &nginxconf.Admin{
+		Servers:    runningServers,
+		ConfigFile: configFile,
+		Version:    version,
+		Token:      mainConf.AdminToken,
+		Reload: func() error {
+			done := make(chan error)
+			reloads <- done
+			return <-done
+		},
+	}
+	admin.SetConfig(source)
+
+	if mainConf.AdminListen != "" {
+		if err := admin.Listen(mainConf.AdminListen, mainConf.AdminSocketMode); err != nil {
+			util.Errorf("failed to listen admin API on %s: %v", mainConf.AdminListen, err)
+		}
+	}
+
+	return admin
+}
+
+func setupErrorLog(mainConf nginxconf.NginxMain) {
+	if mainConf.ErrorLog == "" {
+		return
 	}
 
-	runningServers.Start()
-	select {}
+	if err := util.SetupErrorLog(mainConf.ErrorLog, mainConf.ErrorLogLevel, mainConf.ErrorLogRotate); err != nil {
+		util.Errorf("failed to setup error_log %s: %v", mainConf.ErrorLog, err)
+	}
 }
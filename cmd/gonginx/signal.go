@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/bingoohuang/gonginx/directive"
+	"github.com/bingoohuang/gonginx/nginxconf"
+	"github.com/bingoohuang/gonginx/util"
+)
+
+// signals maps the -s argument to the signal, http://nginx.org/en/docs/control.html
+var signals = map[string]syscall.Signal{
+	"stop":   syscall.SIGTERM,
+	"quit":   syscall.SIGQUIT,
+	"reopen": syscall.SIGUSR1,
+	"reload": syscall.SIGHUP,
+	// upgrade is not in nginx -s, where kill -USR2 is used instead.
+	"upgrade": syscall.SIGUSR2,
+}
+
+// sendSignal sends the named signal to the process recorded in the pid file.
+func sendSignal(pidFile, name string) error {
+	sig, ok := signals[name]
+	if !ok {
+		return fmt.Errorf("invalid signal %q, expected one of stop, quit, reopen, reload, upgrade", name)
+	}
+
+	pid, err := readPid(pidFile)
+	if err != nil {
+		return err
+	}
+
+	p, _ := os.FindProcess(pid)
+	if err := p.Signal(sig); err != nil {
+		if errors.Is(err, os.ErrProcessDone) || errors.Is(err, syscall.ESRCH) {
+			return fmt.Errorf("stale pid file %s: process %d is not running", pidFile, pid)
+		}
+
+		return fmt.Errorf("failed to send %s to process %d: %w", name, pid, err)
+	}
+
+	return nil
+}
+
+func readPid(pidFile string) (int, error) {
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, fmt.Errorf("pid file %s not found, is gonginx running?", pidFile)
+		}
+
+		return 0, fmt.Errorf("failed to read pid file %s: %w", pidFile, err)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid pid %q in pid file %s", strings.TrimSpace(string(data)), pidFile)
+	}
+
+	return pid, nil
+}
+
+func writePid(pidFile string) error {
+	if dir := filepath.Dir(pidFile); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644)
+}
+
+// removePid removes the pid file only when it still records the current process.
+func removePid(pidFile string) {
+	if pid, err := readPid(pidFile); err == nil && pid == os.Getpid() {
+		_ = os.Remove(pidFile)
+	}
+}
+
+// waitSignal handles the control signals until the process is asked to stop.
+// http://nginx.org/en/docs/control.html
+// TERM, INT: fast shutdown; QUIT: graceful shutdown; HUP: reload configuration; USR1: reopen log files;
+// USR2: upgrade the executable file.
+// The reloads requested by the admin API are handled here too, to serialize with the signals.
+func waitSignal(mainConf nginxconf.NginxMain, runningServers *nginxconf.RunningServers,
+	admin *nginxconf.Admin, reloads chan chan error) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	// upgraded means the listeners are handed over to a new process,
+	// which becomes the main process of the service.
+	upgraded := false
+
+	for {
+		var sig os.Signal
+
+		select {
+		case done := <-reloads:
+			util.Infof("reload requested by the admin API")
+			done <- reload(&mainConf, runningServers, admin)
+			continue
+		case sig = <-c:
+		}
+
+		util.Infof("received signal %v", sig)
+
+		switch sig {
+		case syscall.SIGHUP:
+			_ = reload(&mainConf, runningServers, admin)
+		case syscall.SIGUSR1:
+			util.Infof("reopening log files")
+			directive.ReopenLogs()
+
+			if err := util.ReopenErrorLog(); err != nil {
+				util.Errorf("reopen error log failed: %v", err)
+			}
+		case syscall.SIGUSR2:
+			// the admin address is handed over to the new process too.
+			_ = admin.Close()
+
+			if p, err := runningServers.Upgrade(); err != nil {
+				util.Errorf("upgrade failed, keep running: %v", err)
+
+				if mainConf.AdminListen != "" {
+					if err := admin.Listen(mainConf.AdminListen, mainConf.AdminSocketMode); err != nil {
+						util.Errorf("failed to listen admin API on %s: %v", mainConf.AdminListen, err)
+					}
+				}
+			} else {
+				util.Infof("started new process %d to take over the listeners", p.Pid)
+				upgraded = true
+			}
+		case syscall.SIGQUIT:
+			if !upgraded {
+				sdNotify("STOPPING=1")
+			}
+
+			gracefulShutdown(mainConf, runningServers)
+			return
+		default:
+			if !upgraded {
+				sdNotify("STOPPING=1")
+			}
+
+			if err := runningServers.Close(); err != nil {
+				util.Warnf("fast shutdown error: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// notifyUpgradeParent asks the process which handed over the listeners to drain and exit,
+// now that the current process is serving on them.
+func notifyUpgradeParent() {
+	if ppid := nginxconf.UpgradeParent(); ppid > 0 {
+		util.Infof("took over the listeners from process %d, asking it to quit", ppid)
+
+		if err := syscall.Kill(ppid, syscall.SIGQUIT); err != nil {
+			util.Warnf("failed to send QUIT to process %d: %v", ppid, err)
+		}
+	}
+}
+
+// sdNotify tells systemd the service state, MAINPID is included
+// because the main process changes after daemonizing or upgrading.
+func sdNotify(state string) {
+	state = fmt.Sprintf("%s\nMAINPID=%d", state, os.Getpid())
+	if err := util.SdNotify(state); err != nil {
+		util.Warnf("sd_notify %q error: %v", state, err)
+	}
+}
+
+func reload(mainConf *nginxconf.NginxMain, runningServers *nginxconf.RunningServers, admin *nginxconf.Admin) error {
+	sdNotify("RELOADING=1")
+	defer sdNotify("READY=1")
+
+	newConf, servers, source, err := loadConfig()
+	if err != nil {
+		util.Errorf("reload failed, keep running with the old configuration: %v", err)
+		return err
+	}
+
+	if newConf.AdminListen != mainConf.AdminListen {
+		util.Warnf("admin_listen changed to %s, which takes effect after restart", newConf.AdminListen)
+	}
+
+	newConf.AdminListen, newConf.AdminToken = mainConf.AdminListen, mainConf.AdminToken
+
+	newConf.Pid = mainConf.Pid
+	if newConf.ErrorLog != mainConf.ErrorLog || newConf.ErrorLogLevel != mainConf.ErrorLogLevel ||
+		newConf.ErrorLogRotate != mainConf.ErrorLogRotate {
+		setupErrorLog(newConf)
+	}
+
+	*mainConf = newConf
+
+	runningServers.Reload(servers)
+	admin.SetConfig(source)
+	util.Infof("configuration reloaded from %s", configFile)
+
+	return nil
+}
+
+func gracefulShutdown(mainConf nginxconf.NginxMain, runningServers *nginxconf.RunningServers) {
+	ctx := context.Background()
+	if mainConf.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, mainConf.ShutdownTimeout)
+		defer cancel()
+	}
+
+	if err := runningServers.Shutdown(ctx); err != nil {
+		util.Warnf("graceful shutdown error: %v", err)
+	}
+}
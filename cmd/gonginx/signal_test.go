@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSendSignal(t *testing.T) {
+	dir := t.TempDir()
+
+	// the pid of a process already exited, like the one left by a crash.
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("no true command: %v", err)
+	}
+
+	stale := filepath.Join(dir, "stale.pid")
+	_ = os.WriteFile(stale, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0o644)
+
+	invalid := filepath.Join(dir, "invalid.pid")
+	_ = os.WriteFile(invalid, []byte("abc\n"), 0o644)
+
+	tests := []struct {
+		name, pidFile, signal, err string
+	}{
+		{name: "missing pid file", pidFile: filepath.Join(dir, "missing.pid"), signal: "reload", err: "not found"},
+		{name: "stale pid", pidFile: stale, signal: "reload", err: "stale pid file"},
+		{name: "invalid pid", pidFile: invalid, signal: "reload", err: "invalid pid"},
+		{name: "unknown signal", pidFile: stale, signal: "restart", err: "invalid signal \"restart\""},
+	}
+
+	for _, tt := range tests {
+		err := sendSignal(tt.pidFile, tt.signal)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestWritePid(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name   string
+		pid    string
+		remove bool
+	}{
+		{name: "current process", remove: true},
+		{name: "other process", pid: "1\n", remove: false},
+	}
+
+	for _, tt := range tests {
+		pidFile := filepath.Join(dir, tt.name, "logs", "gonginx.pid")
+		if err := writePid(pidFile); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if pid, err := readPid(pidFile); err != nil || pid != os.Getpid() {
+			t.Errorf("%s: expected pid %d, got %d %v", tt.name, os.Getpid(), pid, err)
+		}
+
+		// e.g. overwritten by another process started later.
+		if tt.pid != "" {
+			_ = os.WriteFile(pidFile, []byte(tt.pid), 0o644)
+		}
+
+		removePid(pidFile)
+
+		if _, err := os.Stat(pidFile); os.IsNotExist(err) != tt.remove {
+			t.Errorf("%s: expected removed %v, got %v", tt.name, tt.remove, err)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package directive
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+func init() {
+	RegisterFactory(&accessNaming{})
+	RegisterFactory(&satisfyNaming{})
+}
+
+// AccessChecker is the access processor, checked in the access phase and combined by satisfy.
+type AccessChecker interface {
+	// CheckAccess returns 0 if the access is allowed, or the status denying it, like 403 and 401.
+	CheckAccess(l Location, w http.ResponseWriter, r *http.Request) int
+}
+
+// checkAccess checks the access processors of the location, false if denied and responded.
+// With satisfy all, the first denial denies, while with satisfy any, the first allowance allows,
+// and the denial of 401 takes precedence over the others, like nginx.
+func (l Location) checkAccess(w http.ResponseWriter, r *http.Request) bool {
+	any := false
+
+	for _, p := range l.Processors {
+		if s, ok := p.(*satisfy); ok {
+			any = s.Any
+		}
+	}
+
+	denied := 0
+
+	for _, p := range l.Processors {
+		c, ok := p.(AccessChecker)
+		if !ok {
+			continue
+		}
+
+		code := c.CheckAccess(l, w, r)
+
+		switch {
+		case code == 0 && any:
+			// the challenges of the authentications denied are not needed any more.
+			w.Header().Del("WWW-Authenticate")
+			return true
+		case code == 0:
+		case !any:
+			w.WriteHeader(code)
+			return false
+		case denied != http.StatusUnauthorized:
+			denied = code
+		}
+	}
+
+	if denied != 0 {
+		w.WriteHeader(denied)
+		return false
+	}
+
+	return true
+}
+
+type satisfyNaming struct{}
+
+func (i satisfyNaming) Create() Processor {
+	return &satisfy{satisfyNaming: i}
+}
+
+func (satisfyNaming) Name() map[string]bool {
+	return map[string]bool{
+		"satisfy": true,
+	}
+}
+
+// satisfy means http://nginx.org/en/docs/http/ngx_http_core_module.html#satisfy.
+// Syntax:	satisfy all | any;.
+type satisfy struct {
+	satisfyNaming
+
+	Any bool
+}
+
+func (s *satisfy) GetProcessSeq() ProcessSeq { return Access }
+
+func (s *satisfy) Do(l Location, w http.ResponseWriter, r *http.Request) ProcessResult {
+	return ProcessContinue
+}
+
+func (s *satisfy) Parse(path string, name string, params []string) error {
+	if len(params) != 1 || params[0] != "all" && params[0] != "any" {
+		return ErrSyntax
+	}
+
+	s.Any = params[0] == "any"
+
+	return nil
+}
+
+type accessNaming struct{}
+
+func (i accessNaming) Create() Processor {
+	return &access{accessNaming: i}
+}
+
+func (accessNaming) Name() map[string]bool {
+	return map[string]bool{
+		"allow": true,
+		"deny":  true,
+	}
+}
+
+// access means http://nginx.org/en/docs/http/ngx_http_access_module.html.
+// Syntax:	allow address | CIDR | unix: | all;.
+// Syntax:	deny address | CIDR | unix: | all;.
+// The rules are checked in the order defined until the first match, IPv4 and IPv6 are supported,
+// and unix: matches the requests over the unix sockets.
+type access struct {
+	accessNaming
+
+	Rules []accessRule
+}
+
+type accessRule struct {
+	Allow  bool
+	All    bool
+	Unix   bool
+	Prefix netip.Prefix
+	Text   string
+}
+
+func (a *access) GetProcessSeq() ProcessSeq { return Access }
+
+func (a *access) Do(l Location, w http.ResponseWriter, r *http.Request) ProcessResult {
+	return ProcessContinue
+}
+
+func (a *access) Parse(path string, name string, params []string) error {
+	if len(params) != 1 {
+		return ErrSyntax
+	}
+
+	rule := accessRule{Allow: name == "allow", Text: params[0]}
+
+	switch p := params[0]; {
+	case p == "all":
+		rule.All = true
+	case p == "unix:":
+		rule.Unix = true
+	case strings.Contains(p, "/"):
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return fmt.Errorf("invalid parameter %s: %v", p, err)
+		}
+
+		rule.Prefix = prefix.Masked()
+	default:
+		addr, err := netip.ParseAddr(p)
+		if err != nil {
+			return fmt.Errorf("invalid parameter %s: %v", p, err)
+		}
+
+		rule.Prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+
+	a.Rules = append(a.Rules, rule)
+
+	return nil
+}
+
+func (a *access) CheckAccess(l Location, w http.ResponseWriter, r *http.Request) int {
+	unix := isUnixRequest(r)
+
+	var addr netip.Addr
+	if !unix {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+
+		addr, _ = netip.ParseAddr(host)
+		addr = addr.Unmap()
+	}
+
+	for _, rule := range a.Rules {
+		matched := rule.All || rule.Unix && unix || !unix && addr.IsValid() && rule.Prefix.Contains(addr)
+		if !matched {
+			continue
+		}
+
+		if rule.Allow {
+			return 0
+		}
+
+		ErrorLogOf(r).Errorf("access forbidden by rule")
+
+		return http.StatusForbidden
+	}
+
+	return 0
+}
+
+// isUnixRequest tells whether the request is over a unix socket.
+func isUnixRequest(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+
+	return ok && strings.HasPrefix(addr.Network(), "unix")
+}
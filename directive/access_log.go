@@ -0,0 +1,339 @@
+package directive
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bingoohuang/gonginx/util"
+)
+
+func init() {
+	RegisterFactory(&accessLogNaming{})
+}
+
+type accessLogNaming struct{}
+
+func (i accessLogNaming) Create() Processor {
+	return &accessLog{accessLogNaming: i}
+}
+
+func (accessLogNaming) Name() map[string]bool {
+	return map[string]bool{
+		"access_log": true,
+	}
+}
+
+// accessLog means http://nginx.org/en/docs/http/ngx_http_log_module.html#access_log.
+// Syntax: access_log path [format [buffer=size] [flush=time] [if=condition]];
+// access_log syslog:server=address[,parameter=value] [format [if=condition]];
+// access_log off;.
+// The built-in rotation, not in nginx: [rotate=size|hourly|daily] [keep=number] [compress].
+type accessLog struct {
+	accessLogNaming
+
+	Off     bool
+	Targets []accessLogTarget
+}
+
+type accessLogTarget struct {
+	file   *logFile
+	format *LogFormat
+	cond   *Template
+}
+
+func (a *accessLog) GetProcessSeq() ProcessSeq { return Continue }
+
+func (a *accessLog) Do(l Location, w http.ResponseWriter, r *http.Request) ProcessResult {
+	return ProcessContinue
+}
+
+func (a *accessLog) Parse(path string, name string, params []string) error {
+	if len(params) == 0 {
+		return ErrSyntax
+	}
+
+	if params[0] == "off" {
+		a.Off = true
+		return nil
+	}
+
+	logs := currentLogs()
+	t := accessLogTarget{format: logs.findLogFormat("combined")}
+	bufferSize, flush := 0, time.Duration(0)
+	rotate := util.RotateOption{}
+
+	for i, p := range params[1:] {
+		if ok, err := rotate.ParseRotateParam(p); ok {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(p, "buffer="):
+			size, err := util.ParseSize(strings.TrimPrefix(p, "buffer="))
+			if err != nil {
+				return err
+			}
+			bufferSize = int(size)
+		case strings.HasPrefix(p, "flush="):
+			d, err := util.ParseDuration(strings.TrimPrefix(p, "flush="))
+			if err != nil {
+				return err
+			}
+			flush = d
+		case strings.HasPrefix(p, "if="):
+			cond := ParseTemplate(strings.TrimPrefix(p, "if="))
+			t.cond = &cond
+		case i == 0:
+			if t.format = logs.findLogFormat(p); t.format == nil {
+				return fmt.Errorf("unknown log format %q", p)
+			}
+		default:
+			util.Warnf("unsupported access_log parameter %s", p)
+		}
+	}
+
+	if flush > 0 && bufferSize == 0 {
+		bufferSize = 64 * 1024
+	}
+
+	f, err := logs.openLogFile(params[0], bufferSize, flush, rotate)
+	if err != nil {
+		return err
+	}
+
+	t.file = f
+	a.Targets = append(a.Targets, t)
+
+	return nil
+}
+
+// Log writes the access log of the request.
+func (a *accessLog) Log(l Location, r *http.Request) {
+	if a.Off {
+		return
+	}
+
+	for _, t := range a.Targets {
+		if t.cond != nil {
+			if v := t.cond.Expand(r); v == "" || v == "0" {
+				continue
+			}
+		}
+
+		t.file.Write(t.format.Format(r))
+	}
+}
+
+// logFileQueueSize is the max number of lines waiting to be written.
+const logFileQueueSize = 8192
+
+var (
+	logFilesLock sync.Mutex
+	// logFiles are the log files open, of the running configurations and the ones parsed.
+	logFiles = make(map[*logFile]struct{})
+)
+
+// logFile writes the lines asynchronously, so that logging does not slow the requests.
+type logFile struct {
+	path       string
+	bufferSize int
+	flush      time.Duration
+	rotate     util.RotateOption
+	lines      chan string
+	controls   chan logFileControl
+	dropped    int64
+	// refs is the number of the configurations using the file, which is closed by the last one.
+	refs   int
+	closed atomic.Bool
+}
+
+// logFileControl asks the writing goroutine to flush, and to reopen the file if reopen is true,
+// or to close the file and stop if close is true.
+type logFileControl struct {
+	reopen bool
+	close  bool
+	done   chan struct{}
+}
+
+// openLogFile returns the log file of the path, the same file is shared by all the access_log directives
+// of the configuration, and by the configurations with the same buffer, flush and rotate parameters of it.
+func (l *Logs) openLogFile(path string, bufferSize int, flush time.Duration, rotate util.RotateOption) (*logFile, error) {
+	logFilesLock.Lock()
+	defer logFilesLock.Unlock()
+
+	for _, f := range l.files {
+		if f.path == path {
+			return f, nil
+		}
+	}
+
+	for f := range logFiles {
+		if f.path == path && f.bufferSize == bufferSize && f.flush == flush && f.rotate == rotate {
+			f.refs++
+			l.files = append(l.files, f)
+
+			return f, nil
+		}
+	}
+
+	var (
+		file logWriter
+		err  error
+	)
+
+	if strings.HasPrefix(path, "syslog:") {
+		file, err = util.OpenSyslog(strings.TrimPrefix(path, "syslog:"))
+	} else {
+		file, err = util.OpenRotateFile(path, rotate)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	f := &logFile{
+		path:       path,
+		bufferSize: bufferSize,
+		flush:      flush,
+		rotate:     rotate,
+		lines:      make(chan string, logFileQueueSize),
+		controls:   make(chan logFileControl),
+		refs:       1,
+	}
+	logFiles[f] = struct{}{}
+	l.files = append(l.files, f)
+
+	go f.loop(file, flush)
+
+	return f, nil
+}
+
+// Close releases the log files of the configuration, the ones not used by the other configurations
+// are flushed and closed, e.g. the ones removed or with the parameters changed by a reload.
+func (l *Logs) Close() {
+	logFilesLock.Lock()
+	defer logFilesLock.Unlock()
+
+	for _, f := range l.files {
+		if f.refs--; f.refs > 0 {
+			continue
+		}
+
+		delete(logFiles, f)
+		f.closed.Store(true)
+
+		c := logFileControl{close: true, done: make(chan struct{})}
+		f.controls <- c
+		<-c.done
+	}
+
+	l.files = nil
+}
+
+// Write queues the line, which is dropped when the queue is full.
+func (f *logFile) Write(line string) {
+	if f.closed.Load() {
+		// e.g. by the requests in flight when the configuration is reloaded.
+		return
+	}
+
+	select {
+	case f.lines <- line:
+	default:
+		if atomic.AddInt64(&f.dropped, 1)%1000 == 1 {
+			util.Warnf("access log %s is too slow, %d lines dropped", f.path, atomic.LoadInt64(&f.dropped))
+		}
+	}
+}
+
+// logWriter is the file or the syslog written by the log file.
+type logWriter interface {
+	io.WriteCloser
+	Reopen() error
+}
+
+func (f *logFile) loop(file logWriter, flush time.Duration) {
+	var buf bytes.Buffer
+
+	writeOut := func() {
+		if buf.Len() > 0 {
+			if _, err := file.Write(buf.Bytes()); err != nil {
+				util.Errorf("write access log %s error: %v", f.path, err)
+			}
+			buf.Reset()
+		}
+	}
+
+	var tick <-chan time.Time
+	if flush > 0 {
+		ticker := time.NewTicker(flush)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case line := <-f.lines:
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+
+			// without buffer=, the lines are written as soon as no more lines are pending.
+			if f.bufferSize <= 0 && len(f.lines) == 0 || f.bufferSize > 0 && buf.Len() >= f.bufferSize {
+				writeOut()
+			}
+		case <-tick:
+			writeOut()
+		case c := <-f.controls:
+			for len(f.lines) > 0 {
+				buf.WriteString(<-f.lines)
+				buf.WriteByte('\n')
+			}
+
+			writeOut()
+
+			if c.reopen {
+				if err := file.Reopen(); err != nil {
+					util.Errorf("reopen access log %s error: %v", f.path, err)
+				}
+			}
+
+			if c.close {
+				if err := file.Close(); err != nil {
+					util.Errorf("close access log %s error: %v", f.path, err)
+				}
+
+				close(c.done)
+
+				return
+			}
+
+			close(c.done)
+		}
+	}
+}
+
+func controlLogFiles(reopen bool) {
+	logFilesLock.Lock()
+	defer logFilesLock.Unlock()
+
+	for f := range logFiles {
+		c := logFileControl{reopen: reopen, done: make(chan struct{})}
+		f.controls <- c
+		<-c.done
+	}
+}
+
+// FlushLogs writes out the pending lines of all the log files, e.g. before the process exits.
+func FlushLogs() { controlLogFiles(false) }
+
+// ReopenLogs reopens all the log files, e.g. on USR1 after the files are moved by logrotate.
+func ReopenLogs() { controlLogFiles(true) }
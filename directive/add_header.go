@@ -0,0 +1,127 @@
+package directive
+
+import (
+	"net/http"
+)
+
+func init() {
+	RegisterFactory(&addHeaderNaming{})
+}
+
+type addHeaderNaming struct{}
+
+func (i addHeaderNaming) Create() Processor {
+	return &addHeader{addHeaderNaming: i}
+}
+
+func (addHeaderNaming) Name() map[string]bool {
+	return map[string]bool{
+		"add_header":  true,
+		"add_trailer": true,
+	}
+}
+
+// addHeader means http://nginx.org/en/docs/http/ngx_http_headers_module.html#add_header
+// and http://nginx.org/en/docs/http/ngx_http_headers_module.html#add_trailer.
+// Syntax:	add_header name value [always];.
+// Syntax:	add_trailer name value [always];.
+// The fields are added to the responses of 200, 201, 204, 206, 301, 302, 303, 304, 307 and 308,
+// or any response with always. The fields of the location finally serving the request apply,
+// after the internal redirects like error_page, and the empty values are not added.
+type addHeader struct {
+	addHeaderNaming
+
+	Headers  []headerField
+	Trailers []headerField
+}
+
+type headerField struct {
+	Name   string
+	Value  Template
+	Always bool
+}
+
+func (a *addHeader) GetProcessSeq() ProcessSeq { return Prepare }
+
+func (a *addHeader) Parse(path string, name string, params []string) error {
+	if len(params) < 2 || len(params) > 3 || len(params) == 3 && params[2] != "always" {
+		return ErrSyntax
+	}
+
+	f := headerField{Name: params[0], Value: ParseTemplate(params[1]), Always: len(params) == 3}
+	if name == "add_trailer" {
+		a.Trailers = append(a.Trailers, f)
+	} else {
+		a.Headers = append(a.Headers, f)
+	}
+
+	return nil
+}
+
+// Do does nothing, the headers are added by the hook registered in StartRequest.
+func (a *addHeader) Do(l Location, w http.ResponseWriter, r *http.Request) ProcessResult {
+	return ProcessContinue
+}
+
+// hookAddHeader adds the headers and trailers of the location finally serving the request,
+// after the rewrites and internal redirects, including the redirects by the server level rewrites.
+func hookAddHeader(rc *RequestContext, r *http.Request) {
+	rc.Writer.OnHeader(func(code int) {
+		p := findAddHeader(rc.Location)
+		if p == nil {
+			return
+		}
+
+		h := rc.Writer.Header()
+		p.addFields(h, p.Headers, code, r)
+
+		// the trailers are declared ahead, to send the response chunked.
+		for _, f := range p.Trailers {
+			if f.Always || addHeaderStatus(code) {
+				h.Add("Trailer", f.Name)
+			}
+		}
+	})
+	rc.Writer.OnFinish(func() {
+		if p := findAddHeader(rc.Location); p != nil && rc.Writer.Status != 0 {
+			p.addFields(rc.Writer.Header(), p.Trailers, rc.Writer.Status, r)
+		}
+	})
+}
+
+func (a *addHeader) addFields(h http.Header, fields []headerField, code int, r *http.Request) {
+	for _, f := range fields {
+		if !f.Always && !addHeaderStatus(code) {
+			continue
+		}
+
+		if v := f.Value.Expand(r); v != "" {
+			h.Add(f.Name, v)
+		}
+	}
+}
+
+func findAddHeader(l *Location) *addHeader {
+	if l == nil {
+		return nil
+	}
+
+	for _, p := range l.Processors {
+		if a, ok := p.(*addHeader); ok {
+			return a
+		}
+	}
+
+	return nil
+}
+
+func addHeaderStatus(code int) bool {
+	switch code {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent, http.StatusPartialContent,
+		http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusNotModified,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,94 @@
+package directive
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bingoohuang/gonginx/util"
+)
+
+func init() {
+	RegisterFactory(&authBasicNaming{})
+}
+
+type authBasicNaming struct{}
+
+func (i authBasicNaming) Create() Processor {
+	return &authBasic{authBasicNaming: i}
+}
+
+func (authBasicNaming) Name() map[string]bool {
+	return map[string]bool{
+		"auth_basic":           true,
+		"auth_basic_user_file": true,
+	}
+}
+
+// authBasic means http://nginx.org/en/docs/http/ngx_http_auth_basic_module.html.
+// Syntax:	auth_basic string | off;.
+// Syntax:	auth_basic_user_file file;.
+// The file is in the htpasswd format, with the passwords of bcrypt, {SHA}, $apr1$ or plain text,
+// and loaded again when it changes. The user authenticated is $remote_user.
+type authBasic struct {
+	authBasicNaming
+
+	Realm    Template
+	Off      bool
+	UserFile *util.Htpasswd
+}
+
+func (a *authBasic) GetProcessSeq() ProcessSeq { return Access }
+
+func (a *authBasic) Do(l Location, w http.ResponseWriter, r *http.Request) ProcessResult {
+	return ProcessContinue
+}
+
+func (a *authBasic) Parse(path string, name string, params []string) error {
+	if len(params) != 1 {
+		return ErrSyntax
+	}
+
+	if name == "auth_basic_user_file" {
+		a.UserFile = &util.Htpasswd{Path: params[0]}
+		return nil
+	}
+
+	a.Off = params[0] == "off"
+	a.Realm = ParseTemplate(params[0])
+
+	return nil
+}
+
+func (a *authBasic) CheckAccess(l Location, w http.ResponseWriter, r *http.Request) int {
+	if a.Off || a.UserFile == nil {
+		return 0
+	}
+
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return a.unauthorized(w, r)
+	}
+
+	found, matched, err := a.UserFile.Verify(user, password)
+
+	switch {
+	case err != nil:
+		ErrorLogOf(r).Errorf("open() \"%s\" failed: %v", a.UserFile.Path, err)
+		return http.StatusInternalServerError
+	case !found:
+		ErrorLogOf(r).Errorf("user \"%s\" was not found in \"%s\"", user, a.UserFile.Path)
+		return a.unauthorized(w, r)
+	case !matched:
+		ErrorLogOf(r).Errorf("user \"%s\": password mismatch", user)
+		return a.unauthorized(w, r)
+	}
+
+	return 0
+}
+
+func (a *authBasic) unauthorized(w http.ResponseWriter, r *http.Request) int {
+	realm := strings.ReplaceAll(a.Realm.Expand(r), `"`, `\"`)
+	w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`"`)
+
+	return http.StatusUnauthorized
+}
@@ -0,0 +1,169 @@
+package directive
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bingoohuang/gonginx/util"
+)
+
+func init() {
+	RegisterFactory(&authJWTNaming{})
+}
+
+type authJWTNaming struct{}
+
+func (i authJWTNaming) Create() Processor {
+	return &authJWT{authJWTNaming: i}
+}
+
+func (authJWTNaming) Name() map[string]bool {
+	return map[string]bool{
+		"auth_jwt":          true,
+		"auth_jwt_key_file": true,
+		"auth_jwt_issuer":   true,
+		"auth_jwt_audience": true,
+	}
+}
+
+// authJWT means http://nginx.org/en/docs/http/ngx_http_auth_jwt_module.html.
+// Syntax:	auth_jwt string [token=$variable] | off;.
+// Syntax:	auth_jwt_key_file file;.
+// Syntax:	auth_jwt_issuer string;.
+// Syntax:	auth_jwt_audience string;.
+// The token is the bearer one of the Authorization header by default, signed by HS256, RS256, ES256
+// and their 384 and 512 variants, with the keys in PEM or JWKS. The claims exp and nbf are validated,
+// and iss and aud too if required. The claims are $jwt_claim_sub and so on, the header $jwt_header_alg.
+type authJWT struct {
+	authJWTNaming
+
+	Realm    Template
+	On       bool
+	Token    *Template
+	KeyFile  *util.JWTKeys
+	Issuer   string
+	Audience string
+}
+
+func (a *authJWT) GetProcessSeq() ProcessSeq { return Access }
+
+func (a *authJWT) Do(l Location, w http.ResponseWriter, r *http.Request) ProcessResult {
+	return ProcessContinue
+}
+
+func (a *authJWT) Parse(path string, name string, params []string) error {
+	switch name {
+	case "auth_jwt":
+		if len(params) < 1 || len(params) > 2 {
+			return ErrSyntax
+		}
+
+		a.On = params[0] != "off"
+		a.Realm = ParseTemplate(params[0])
+
+		if len(params) == 2 {
+			token, ok := strings.CutPrefix(params[1], "token=")
+			if !ok || token == "" {
+				return ErrSyntax
+			}
+
+			t := ParseTemplate(token)
+			a.Token = &t
+		}
+
+		return nil
+	}
+
+	if len(params) != 1 {
+		return ErrSyntax
+	}
+
+	switch name {
+	case "auth_jwt_key_file":
+		a.KeyFile = &util.JWTKeys{Path: params[0]}
+	case "auth_jwt_issuer":
+		a.Issuer = params[0]
+	case "auth_jwt_audience":
+		a.Audience = params[0]
+	}
+
+	return nil
+}
+
+func (a *authJWT) CheckAccess(l Location, w http.ResponseWriter, r *http.Request) int {
+	if !a.On {
+		return 0
+	}
+
+	if a.KeyFile == nil {
+		ErrorLogOf(r).Errorf("JWT: no auth_jwt_key_file defined")
+		return http.StatusInternalServerError
+	}
+
+	token := a.token(r)
+	if token == "" {
+		return a.unauthorized(w, r, false)
+	}
+
+	keys, err := a.KeyFile.Load()
+	if err != nil {
+		ErrorLogOf(r).Errorf("JWT: failed to load the keys \"%s\": %v", a.KeyFile.Path, err)
+		return http.StatusInternalServerError
+	}
+
+	t, err := util.ParseJWT(token, keys)
+	if err == nil {
+		err = t.Validate(time.Now(), a.Issuer, a.Audience)
+	}
+
+	if err != nil {
+		ErrorLogOf(r).Infof("JWT: %v", err)
+		return a.unauthorized(w, r, true)
+	}
+
+	GetRequestContext(r).JWT = t
+
+	return 0
+}
+
+// token returns the token of the variable by token=, or the bearer one of the Authorization header.
+func (a *authJWT) token(r *http.Request) string {
+	if a.Token != nil {
+		return a.Token.Expand(r)
+	}
+
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
+
+func (a *authJWT) unauthorized(w http.ResponseWriter, r *http.Request, invalid bool) int {
+	challenge := `Bearer realm="` + strings.ReplaceAll(a.Realm.Expand(r), `"`, `\"`) + `"`
+	if invalid {
+		challenge += `, error="invalid_token"`
+	}
+
+	w.Header().Set("WWW-Authenticate", challenge)
+
+	return http.StatusUnauthorized
+}
+
+// jwtValue returns the claim, or the header field, of the token validated by auth_jwt.
+func (rc *RequestContext) jwtValue(name string, header bool) string {
+	if rc.JWT == nil {
+		return ""
+	}
+
+	var v string
+	if header {
+		v, _ = rc.JWT.HeaderValue(name)
+	} else {
+		v, _ = rc.JWT.Claim(name)
+	}
+
+	return v
+}
@@ -0,0 +1,150 @@
+package directive
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterFactory(&authRequestNaming{})
+}
+
+type authRequestNaming struct{}
+
+func (i authRequestNaming) Create() Processor {
+	return &authRequest{authRequestNaming: i}
+}
+
+func (authRequestNaming) Name() map[string]bool {
+	return map[string]bool{
+		"auth_request":     true,
+		"auth_request_set": true,
+	}
+}
+
+// authRequest means http://nginx.org/en/docs/http/ngx_http_auth_request_module.html.
+// Syntax:	auth_request uri | off;.
+// Syntax:	auth_request_set $variable value;.
+// The access is checked by the subrequest GET uri without the body, 2xx allows, 401 and 403 deny,
+// and the others are errors. The values of auth_request_set are evaluated after the subrequest,
+// e.g. $upstream_http_x_user of its upstream response, and set to the variables of the request.
+type authRequest struct {
+	authRequestNaming
+
+	URI  string
+	Off  bool
+	Vars []authRequestVar
+}
+
+type authRequestVar struct {
+	Name  string
+	Value Template
+}
+
+func (a *authRequest) GetProcessSeq() ProcessSeq { return Access }
+
+func (a *authRequest) Do(l Location, w http.ResponseWriter, r *http.Request) ProcessResult {
+	return ProcessContinue
+}
+
+func (a *authRequest) Parse(path string, name string, params []string) error {
+	if name == "auth_request_set" {
+		if len(params) != 2 || !strings.HasPrefix(params[0], "$") || len(params[0]) == 1 {
+			return ErrSyntax
+		}
+
+		a.Vars = append(a.Vars, authRequestVar{Name: params[0][1:], Value: ParseTemplate(params[1])})
+
+		return nil
+	}
+
+	if len(params) != 1 {
+		return ErrSyntax
+	}
+
+	a.Off = params[0] == "off"
+	a.URI = params[0]
+
+	return nil
+}
+
+func (a *authRequest) CheckAccess(l Location, w http.ResponseWriter, r *http.Request) int {
+	if a.Off || a.URI == "" {
+		return 0
+	}
+
+	sr, srw := a.subrequest(r)
+	src := GetRequestContext(sr)
+
+	if sl := src.Locations.FindLocation(sr); sl != nil {
+		src.Location = sl
+		sl.ServeHTTP(srw, sr)
+	} else {
+		srw.WriteHeader(http.StatusNotFound)
+	}
+
+	rc := GetRequestContext(r)
+	for _, v := range a.Vars {
+		if rc.Vars == nil {
+			rc.Vars = make(map[string]string)
+		}
+
+		rc.Vars[v.Name] = v.Value.Expand(sr)
+	}
+
+	switch code := srw.Status; {
+	case code >= 200 && code < 300:
+		return 0
+	case code == http.StatusUnauthorized:
+		for _, v := range srw.Header().Values("WWW-Authenticate") {
+			w.Header().Add("WWW-Authenticate", v)
+		}
+
+		return code
+	case code == http.StatusForbidden:
+		return code
+	default:
+		ErrorLogOf(r).Errorf("auth request unexpected status: %d", code)
+		return http.StatusInternalServerError
+	}
+}
+
+// subrequest creates the subrequest of auth_request, with its own RequestContext,
+// and the response discarded but the status and the headers.
+func (a *authRequest) subrequest(r *http.Request) (*http.Request, *ResponseWriter) {
+	rc := GetRequestContext(r)
+	srw := &ResponseWriter{ResponseWriter: &discardWriter{header: make(http.Header)}}
+	src := &RequestContext{
+		Start:      time.Now(),
+		ServerName: rc.ServerName,
+		Writer:     srw,
+		Locations:  rc.Locations,
+		Named:      rc.Named,
+		subrequest: true,
+	}
+
+	sr := r.Clone(context.WithValue(r.Context(), requestContextKey{}, src))
+	sr.Method = http.MethodGet
+	sr.Body, sr.ContentLength = http.NoBody, 0
+	sr.Header.Del("Content-Length")
+	sr.Header.Del("Transfer-Encoding")
+
+	u, err := url.Parse(a.URI)
+	if err == nil {
+		sr.URL.Path, sr.URL.RawPath, sr.URL.RawQuery = u.Path, "", u.RawQuery
+	}
+
+	return sr, srw
+}
+
+// discardWriter discards the response body of the subrequests.
+type discardWriter struct {
+	header http.Header
+}
+
+func (d *discardWriter) Header() http.Header         { return d.header }
+func (d *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d *discardWriter) WriteHeader(int)             {}
@@ -0,0 +1,276 @@
+package directive
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/bingoohuang/gonginx/util"
+)
+
+// RequestContext holds the per-request state shared by the processors and the logs.
+type RequestContext struct {
+	Start      time.Time
+	ServerName string
+	Writer     *ResponseWriter
+	// Location is the location matched to serve the request.
+	Location *Location
+	// Locations and Named are the locations of the server, for the internal redirects.
+	Locations Locations
+	Named     map[string]*Location
+	// Redirects counts the internal redirects, to break the cycles.
+	Redirects int
+	// ifMatched is the body of the last if matched in the location, which serves the request after the rewrite phase.
+	ifMatched *Location
+	// rewriteStopped tells the rewrite phase is stopped by the last or break flag of rewrite, the later ifs are not evaluated.
+	rewriteStopped bool
+	// uriChanged tells the URI is changed by rewrite, the location is searched again after the rewrite phase.
+	uriChanged bool
+	// errorPageServed tells the error page is served, the errors of which are not intercepted again.
+	errorPageServed bool
+	// Vars are the variables set by the directives, like auth_request_set, the names are without the leading $.
+	Vars map[string]string
+	// subrequest tells the request is a subrequest, like auth_request, which skips the access phase.
+	subrequest bool
+	// JWT is the token validated by auth_jwt, for the variables like $jwt_claim_sub.
+	JWT *util.JWT
+	// LimitReqStatus is the result of limit_req, like PASSED and REJECTED.
+	LimitReqStatus string
+	// requestHeaderBytes and requestBodyBytes are the bytes of the request read, for $request_length.
+	requestHeaderBytes int64
+	requestBodyBytes   atomic.Int64
+	// Captures are the regex captures of the last match by rewrite, like "1" and the named ones.
+	Captures map[string]string
+
+	// UpstreamAddr is the address of the upstream server proxied to.
+	UpstreamAddr string
+	// UpstreamStatus is the status of the upstream response, 502 if the upstream is unavailable.
+	UpstreamStatus int
+	// UpstreamError is the error to connect or read the upstream.
+	UpstreamError error
+	// UpstreamResponseTime is the time spent on the upstream.
+	UpstreamResponseTime time.Duration
+	// UpstreamHeader is the header of the upstream response.
+	UpstreamHeader http.Header
+}
+
+type requestContextKey struct{}
+
+// setCaptures replaces the captures by the matches of the regex, with the named captures.
+func (rc *RequestContext) setCaptures(matches []string, re *util.PCRE) {
+	rc.Captures = make(map[string]string, 2*len(matches))
+
+	// the unset captures at the end may be absent in the matches.
+	for i, name := range re.Names {
+		var v string
+		if i < len(matches) {
+			v = matches[i]
+		}
+
+		rc.Captures[strconv.Itoa(i)] = v
+		if name != "" {
+			rc.Captures[name] = v
+		}
+	}
+}
+
+// StartRequest attaches a new RequestContext to the request,
+// and wraps the http.ResponseWriter to record the response status and size.
+func StartRequest(w http.ResponseWriter, r *http.Request, serverName string) (*ResponseWriter, *http.Request) {
+	rw := &ResponseWriter{ResponseWriter: w}
+	Connections.AddRequest()
+
+	rc := &RequestContext{
+		Start:      time.Now(),
+		ServerName: serverName,
+		Writer:     rw,
+	}
+	rw.intercept = rc.interceptError
+
+	r = r.WithContext(context.WithValue(r.Context(), requestContextKey{}, rc))
+	rc.requestHeaderBytes = requestHeaderSize(r)
+
+	// the response hooks decide by the location finally serving the request, set later.
+	hookAddHeader(rc, r)
+	hookDebugHeaders(rc)
+
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &countingBody{ReadCloser: r.Body, n: &rc.requestBodyBytes}
+	}
+
+	return rw, r
+}
+
+// countingBody counts the bytes of the request body read, for $request_length.
+type countingBody struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+
+	return n, err
+}
+
+// RequestLength returns the bytes of the request line, the header and the body read so far.
+func (rc *RequestContext) RequestLength() int64 {
+	return rc.requestHeaderBytes + rc.requestBodyBytes.Load()
+}
+
+// GetRequestContext returns the RequestContext of the request, a blank one if absent.
+func GetRequestContext(r *http.Request) *RequestContext {
+	if rc, ok := r.Context().Value(requestContextKey{}).(*RequestContext); ok {
+		return rc
+	}
+
+	return &RequestContext{Start: time.Now(), Writer: &ResponseWriter{}}
+}
+
+// ResponseWriter records the status and the size of the response.
+type ResponseWriter struct {
+	http.ResponseWriter
+
+	Status      int
+	HeaderBytes int64
+	BodyBytes   int64
+
+	onHeader []func(code int)
+	onFinish []func()
+	// intercept tells whether the response of the error status is replaced by another one, like error_page.
+	intercept func(code int) bool
+	// Intercepted is the error status intercepted, the response is discarded until replaced.
+	Intercepted int
+	// StatusOverride replaces the status of the response, like error_page 404 =200.
+	StatusOverride int
+}
+
+// OnHeader registers the function called with the status just before the response header is sent,
+// e.g. to add the response headers.
+func (w *ResponseWriter) OnHeader(f func(code int)) {
+	w.onHeader = append(w.onHeader, f)
+}
+
+// OnFinish registers the function called after the response body is written, e.g. to add the trailers.
+func (w *ResponseWriter) OnFinish(f func()) {
+	w.onFinish = append(w.onFinish, f)
+}
+
+// Finish runs the functions registered by OnFinish, when the request is served.
+func (w *ResponseWriter) Finish() {
+	for _, f := range w.onFinish {
+		f()
+	}
+}
+
+func (w *ResponseWriter) sendHeader(code int) {
+	w.Status = code
+
+	for _, f := range w.onHeader {
+		f(code)
+	}
+
+	w.HeaderBytes = headerSize(code, w.Header())
+}
+
+func (w *ResponseWriter) WriteHeader(code int) {
+	if w.Intercepted != 0 {
+		return
+	}
+
+	if w.Status == 0 && code >= http.StatusMultipleChoices && w.intercept != nil && w.intercept(code) {
+		w.Intercepted = code
+
+		for k := range w.Header() {
+			delete(w.Header(), k)
+		}
+
+		return
+	}
+
+	if w.StatusOverride != 0 && code >= http.StatusOK {
+		code = w.StatusOverride
+	}
+
+	// informational responses, like 103 Early Hints, are followed by the final one.
+	if w.Status == 0 && code >= http.StatusOK {
+		w.sendHeader(code)
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	if w.Intercepted != 0 {
+		return len(b), nil
+	}
+
+	if w.Status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	n, err := w.ResponseWriter.Write(b)
+	w.BodyBytes += int64(n)
+
+	return n, err
+}
+
+// Flush implements http.Flusher for the streaming responses.
+func (w *ResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker for the protocol upgrades, like WebSocket.
+func (w *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("http.Hijacker is not supported")
+	}
+
+	if w.Status == 0 {
+		w.Status = http.StatusSwitchingProtocols
+	}
+
+	return hj.Hijack()
+}
+
+// Unwrap returns the original http.ResponseWriter for http.ResponseController.
+func (w *ResponseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// requestHeaderSize returns the size of the request line and the header, like "GET / HTTP/1.1\r\nHost: a\r\n\r\n".
+func requestHeaderSize(r *http.Request) int64 {
+	size := int64(len(r.Method) + len(" ") + len(r.RequestURI) + len(" ") + len(r.Proto) + len("\r\n\r\n"))
+	if r.Host != "" {
+		size += int64(len("Host: \r\n") + len(r.Host))
+	}
+
+	for k, vv := range r.Header {
+		for _, v := range vv {
+			size += int64(len(k) + len(": \r\n") + len(v))
+		}
+	}
+
+	return size
+}
+
+// headerSize estimates the size of the response status line and headers.
+func headerSize(code int, h http.Header) int64 {
+	size := int64(len("HTTP/1.1 000 \r\n\r\n") + len(http.StatusText(code)))
+
+	for k, vv := range h {
+		for _, v := range vv {
+			size += int64(len(k) + len(": \r\n") + len(v))
+		}
+	}
+
+	return size
+}
@@ -0,0 +1,81 @@
+package directive
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func init() {
+	RegisterFactory(&debugHeadersNaming{})
+}
+
+type debugHeadersNaming struct{}
+
+func (i debugHeadersNaming) Create() Processor {
+	return &debugHeaders{debugHeadersNaming: i}
+}
+
+func (debugHeadersNaming) Name() map[string]bool {
+	return map[string]bool{
+		"debug_headers": true,
+	}
+}
+
+// debugHeaders is not in nginx, it adds the routing decisions into the response headers.
+// Syntax: debug_headers on | off;.
+// X-Gonginx-Server: the server name, X-Gonginx-Location: the location and its seq, like "^~ /api #2",
+// X-Gonginx-Upstream: the upstream address proxied to.
+type debugHeaders struct {
+	debugHeadersNaming
+
+	On bool
+}
+
+func (d *debugHeaders) Parse(path string, name string, params []string) error {
+	if len(params) != 1 || params[0] != "on" && params[0] != "off" {
+		return ErrSyntax
+	}
+
+	d.On = params[0] == "on"
+
+	return nil
+}
+
+func (d *debugHeaders) GetProcessSeq() ProcessSeq { return Prepare }
+
+// Do does nothing, the headers are added by the hook registered in StartRequest.
+func (d *debugHeaders) Do(l Location, w http.ResponseWriter, r *http.Request) ProcessResult {
+	return ProcessContinue
+}
+
+// hookDebugHeaders adds the headers when the debug_headers of the location finally serving the request is on,
+// after the internal redirects.
+func hookDebugHeaders(rc *RequestContext) {
+	rc.Writer.OnHeader(func(int) {
+		if d := findDebugHeaders(rc.Location); d == nil || !d.On {
+			return
+		}
+
+		h := rc.Writer.Header()
+		h.Set("X-Gonginx-Server", rc.ServerName)
+		h.Set("X-Gonginx-Location", fmt.Sprintf("%s #%d", rc.Location, rc.Location.Seq))
+
+		if rc.UpstreamAddr != "" {
+			h.Set("X-Gonginx-Upstream", rc.UpstreamAddr)
+		}
+	})
+}
+
+func findDebugHeaders(l *Location) *debugHeaders {
+	if l == nil {
+		return nil
+	}
+
+	for _, p := range l.Processors {
+		if d, ok := p.(*debugHeaders); ok {
+			return d
+		}
+	}
+
+	return nil
+}
@@ -24,7 +24,8 @@ type defaultType struct {
 	Value string
 }
 
-func (r *defaultType) GetProcessSeq() ProcessSeq { return Continue }
+// GetProcessSeq sets the header ahead of the responses, like return and echo.
+func (r *defaultType) GetProcessSeq() ProcessSeq { return Prepare }
 
 func (r *defaultType) Do(l Location, w http.ResponseWriter, rq *http.Request) ProcessResult {
 	w.Header().Set("Content-Type", r.Value)
@@ -0,0 +1,87 @@
+package directive
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/bingoohuang/gonginx/util"
+)
+
+func init() {
+	RegisterFactory(&errorLogNaming{})
+}
+
+type errorLogNaming struct{}
+
+func (i errorLogNaming) Create() Processor {
+	return &errorLog{errorLogNaming: i}
+}
+
+func (errorLogNaming) Name() map[string]bool {
+	return map[string]bool{
+		"error_log": true,
+	}
+}
+
+// errorLog means http://nginx.org/en/docs/ngx_core_module.html#error_log in the http, server and location levels.
+// Syntax: error_log file|stderr|syslog:... [level];.
+// The built-in rotation, not in nginx: [rotate=size|hourly|daily] [keep=number] [compress].
+type errorLog struct {
+	errorLogNaming
+
+	Log util.ErrorLog
+}
+
+func (e *errorLog) GetProcessSeq() ProcessSeq { return Continue }
+
+func (e *errorLog) Do(l Location, w http.ResponseWriter, r *http.Request) ProcessResult {
+	return ProcessContinue
+}
+
+func (e *errorLog) Parse(path string, name string, params []string) error {
+	if len(params) == 0 {
+		return ErrSyntax
+	}
+
+	level := util.LevelError
+	rotate := util.RotateOption{}
+
+	for _, p := range params[1:] {
+		if l, ok := util.ParseLevel(p); ok {
+			level = l
+		} else if ok, err := rotate.ParseRotateParam(p); !ok || err != nil {
+			return fmt.Errorf("invalid error_log parameter %s: %v", p, err)
+		}
+	}
+
+	w, err := util.OpenErrorLogWriter(params[0], rotate)
+	if err != nil {
+		return err
+	}
+
+	e.Log.Outputs = append(e.Log.Outputs, util.ErrorOutput{Level: level, Writer: w})
+
+	return nil
+}
+
+// ErrorLogOf returns the error log of the location serving the request,
+// with the client, server and request information appended to the messages, like nginx.
+func ErrorLogOf(r *http.Request) util.ErrorLog {
+	rc := GetRequestContext(r)
+
+	var el util.ErrorLog
+
+	if rc.Location != nil {
+		for _, p := range rc.Location.Processors {
+			if e, ok := p.(*errorLog); ok {
+				el = e.Log
+				break
+			}
+		}
+	}
+
+	client, _ := Variable("remote_addr", r)
+
+	return el.With(fmt.Sprintf(", client: %s, server: %s, request: \"%s %s %s\"",
+		client, rc.ServerName, r.Method, r.RequestURI, r.Proto))
+}
@@ -0,0 +1,171 @@
+package directive
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	RegisterFactory(&errorPageNaming{})
+}
+
+type errorPageNaming struct{}
+
+func (i errorPageNaming) Create() Processor {
+	return &errorPage{errorPageNaming: i, Pages: make(map[int]errorPageTarget)}
+}
+
+func (errorPageNaming) Name() map[string]bool {
+	return map[string]bool{
+		"error_page":             true,
+		"proxy_intercept_errors": true,
+	}
+}
+
+// errorPage means http://nginx.org/en/docs/http/ngx_http_core_module.html#error_page
+// and http://nginx.org/en/docs/http/ngx_http_proxy_module.html#proxy_intercept_errors.
+// Syntax:	error_page code ... [=[response]] uri;.
+// Syntax:	proxy_intercept_errors on | off;.
+// The error responses are discarded and replaced by the uri served by an internal redirect,
+// a named location like @maintenance, or a redirect to the URL.
+// The upstream responses are replaced only when proxy_intercept_errors is on.
+type errorPage struct {
+	errorPageNaming
+
+	Pages           map[int]errorPageTarget
+	InterceptErrors bool
+}
+
+type errorPageTarget struct {
+	URI Template
+	// Code is the status of the response, keepStatus for the error one, 0 for the one of the page by "=".
+	Code int
+}
+
+// keepStatus keeps the error status for the error page response.
+const keepStatus = -1
+
+func (e *errorPage) GetProcessSeq() ProcessSeq { return Prepare }
+
+func (e *errorPage) Do(l Location, w http.ResponseWriter, r *http.Request) ProcessResult {
+	return ProcessContinue
+}
+
+func (e *errorPage) Parse(path string, name string, params []string) error {
+	if name == "proxy_intercept_errors" {
+		if len(params) != 1 || params[0] != "on" && params[0] != "off" {
+			return ErrSyntax
+		}
+
+		e.InterceptErrors = params[0] == "on"
+
+		return nil
+	}
+
+	if len(params) < 2 {
+		return ErrSyntax
+	}
+
+	target := errorPageTarget{URI: ParseTemplate(params[len(params)-1]), Code: keepStatus}
+	codes := params[:len(params)-1]
+
+	if last := codes[len(codes)-1]; strings.HasPrefix(last, "=") {
+		codes = codes[:len(codes)-1]
+		target.Code = 0
+
+		if last != "=" {
+			code, err := strconv.Atoi(last[1:])
+			if err != nil {
+				return fmt.Errorf("invalid response code %s", last)
+			}
+
+			target.Code = code
+		}
+	}
+
+	if len(codes) == 0 {
+		return ErrSyntax
+	}
+
+	for _, c := range codes {
+		code, err := strconv.Atoi(c)
+		if err != nil || code < 300 || code > 599 {
+			return fmt.Errorf("value %s must be between 300 and 599", c)
+		}
+
+		e.Pages[code] = target
+	}
+
+	return nil
+}
+
+func findErrorPage(l *Location) *errorPage {
+	if l == nil {
+		return nil
+	}
+
+	for _, p := range l.Processors {
+		if e, ok := p.(*errorPage); ok {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// interceptError tells whether the error response is replaced by the error page of the location,
+// the upstream responses only by proxy_intercept_errors on.
+func (rc *RequestContext) interceptError(code int) bool {
+	e := findErrorPage(rc.Location)
+	if rc.errorPageServed || e == nil {
+		return false
+	}
+
+	if _, ok := e.Pages[code]; !ok {
+		return false
+	}
+
+	upstream := rc.UpstreamStatus != 0 && rc.UpstreamError == nil
+
+	return !upstream || e.InterceptErrors
+}
+
+// serveErrorPage serves the error page for the error status intercepted, the errors of the page are not intercepted.
+func serveErrorPage(w http.ResponseWriter, r *http.Request, code int) {
+	rc := GetRequestContext(r)
+	rc.Writer.Intercepted = 0
+	rc.errorPageServed = true
+
+	page := findErrorPage(rc.Location).Pages[code]
+	uri := page.URI.Expand(r)
+
+	ErrorLogOf(r).Debugf("error page for %d: \"%s\"", code, uri)
+
+	if isRedirectURL(uri) {
+		status := http.StatusFound
+		if isRedirectCode(page.Code) {
+			status = page.Code
+		}
+
+		w.Header().Set("Location", uri)
+		w.WriteHeader(status)
+
+		return
+	}
+
+	switch page.Code {
+	case keepStatus:
+		rc.Writer.StatusOverride = code
+	case 0:
+	default:
+		rc.Writer.StatusOverride = page.Code
+	}
+
+	if r.Method != http.MethodHead {
+		r.Method = http.MethodGet
+	}
+
+	InternalRedirect(w, r, uri)
+}
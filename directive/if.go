@@ -0,0 +1,170 @@
+package directive
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/bingoohuang/gonginx/util"
+)
+
+// Condition is the condition of if, http://nginx.org/en/docs/http/ngx_http_rewrite_module.html#if.
+//
+//	$variable                    false if empty or "0"
+//	$variable = string, !=       string comparison
+//	$variable ~ regex, ~*, !~, !~*  regex matching, the captures are available to the later directives
+//	-f file, -d, -e, -x, !-f ...  file, directory, existence and executable checks
+type Condition struct {
+	Operator string
+	Left     Template
+	Right    Template
+	Regex    *util.PCRE
+	Negative bool
+}
+
+// ParseCondition parses the words of the condition as the lexer gives them, with the quotes removed,
+// like ["($http_user_agent", "~*", "foo bar", ")"], where the parentheses are attached to the first and last words or not.
+func ParseCondition(words []string) (c Condition, err error) {
+	expr := strings.Join(words, " ")
+	if len(words) == 0 || !strings.HasPrefix(words[0], "(") || !strings.HasSuffix(words[len(words)-1], ")") {
+		return c, fmt.Errorf("invalid condition %s, expected in parentheses", expr)
+	}
+
+	words = append([]string(nil), words...)
+
+	if words[0] = words[0][1:]; words[0] == "" {
+		words = words[1:]
+	}
+
+	// the empty words are kept except the parentheses, like the "" of ($a = "").
+	if last := len(words) - 1; last >= 0 {
+		if words[last] = strings.TrimSuffix(words[last], ")"); words[last] == "" {
+			words = words[:last]
+		}
+	}
+
+	switch len(words) {
+	case 1:
+		c.Left = ParseTemplate(words[0])
+		return c, nil
+	case 2:
+		op := strings.TrimPrefix(words[0], "!")
+		switch op {
+		case "-f", "-d", "-e", "-x":
+			c.Operator, c.Negative, c.Left = op, op != words[0], ParseTemplate(words[1])
+			return c, nil
+		}
+	case 3:
+		c.Left = ParseTemplate(words[0])
+
+		switch op := words[1]; op {
+		case "=", "!=":
+			c.Operator, c.Negative, c.Right = "=", op == "!=", ParseTemplate(words[2])
+			return c, nil
+		case "~", "~*", "!~", "!~*":
+			expr := words[2]
+			if strings.HasSuffix(op, "*") {
+				expr = "(?i)" + expr
+			}
+
+			c.Operator, c.Negative = "~", strings.HasPrefix(op, "!")
+			c.Regex, err = CompileRegex(expr)
+
+			return c, err
+		}
+	}
+
+	return c, fmt.Errorf("invalid condition %s", expr)
+}
+
+// Eval evaluates the condition for the request, the regex captures are recorded when matched.
+func (c Condition) Eval(r *http.Request) bool {
+	left := c.Left.Expand(r)
+
+	var result bool
+
+	switch c.Operator {
+	case "":
+		result = left != "" && left != "0"
+	case "=":
+		result = left == c.Right.Expand(r)
+	case "~":
+		if matches := c.Regex.FindStringSubmatch(left); matches != nil {
+			result = true
+			if !c.Negative {
+				GetRequestContext(r).setCaptures(matches, c.Regex)
+			}
+		}
+	default:
+		result = fileCheck(c.Operator, left)
+	}
+
+	return result != c.Negative
+}
+
+func fileCheck(op, name string) bool {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return false
+	}
+
+	switch op {
+	case "-f":
+		return fi.Mode().IsRegular()
+	case "-d":
+		return fi.IsDir()
+	case "-x":
+		return !fi.IsDir() && fi.Mode()&0o111 != 0
+	default:
+		return true
+	}
+}
+
+// If is the if block in the server and location levels, created by the configuration parser with its body.
+// Like nginx, the rewrite directives of the body run when the condition is true, and at the location level,
+// the body of the last if matched serves the request instead of the location, see Location.serve.
+// The body of the server level runs its rewrites only, ahead of the location matching.
+type If struct {
+	Condition Condition
+	Body      Location
+	// Server tells the if is at the server level.
+	Server bool
+}
+
+func (*If) Name() map[string]bool { return map[string]bool{"if": true} }
+
+func (*If) GetProcessSeq() ProcessSeq { return Rewrite }
+
+func (*If) Parse(path string, name string, params []string) error {
+	return fmt.Errorf("if is parsed with its block")
+}
+
+func (i *If) Do(l Location, w http.ResponseWriter, r *http.Request) ProcessResult {
+	if !i.Condition.Eval(r) {
+		return ProcessContinue
+	}
+
+	if i.Server {
+		if i.Body.Rewrite(w, r) {
+			return ProcessTerminate
+		}
+
+		return ProcessContinue
+	}
+
+	rc := GetRequestContext(r)
+	rc.ifMatched = &i.Body
+
+	for _, v := range i.Body.Processors {
+		if rc.rewriteStopped {
+			break
+		}
+
+		if v.GetProcessSeq() == Rewrite && v.Do(i.Body, w, r) == ProcessTerminate {
+			return ProcessTerminate
+		}
+	}
+
+	return ProcessContinue
+}
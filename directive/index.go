@@ -70,14 +70,15 @@ func (i *index) Do(l Location, w http.ResponseWriter, r *http.Request) ProcessRe
 	serveFile := r.URL.Path
 
 	switch {
-	case i.Root != "":
-		// http://nginx.org/en/docs/http/ngx_http_core_module.html#root
-		serveFile = filepath.Join(i.Root, serveFile)
 	case i.Alias != "":
 		// http://nginx.org/en/docs/http/ngx_http_core_module.html#alias
 		// location /i/ { alias /data/w3/images/; }
 		// on request of “/i/top.gif”, the file /data/w3/images/top.gif will be sent.
+		// alias takes precedence over the root inherited from the server level.
 		serveFile = filepath.Join(i.Alias, strings.TrimPrefix(r.URL.Path, l.Path))
+	case i.Root != "":
+		// http://nginx.org/en/docs/http/ngx_http_core_module.html#root
+		serveFile = filepath.Join(i.Root, serveFile)
 	default:
 		serveFile = strings.TrimPrefix(serveFile, "/")
 	}
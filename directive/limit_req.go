@@ -0,0 +1,381 @@
+package directive
+
+import (
+	"container/list"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/gonginx/util"
+)
+
+func init() {
+	RegisterFactory(&limitReqNaming{})
+}
+
+// limitReqStateSize is the size of a state in the zone, like nginx, where one megabyte keeps about 16 thousand states.
+const limitReqStateSize = 64
+
+// LimitReqZone is the shared zone of the request states, keyed by the variables, like $binary_remote_addr.
+// http://nginx.org/en/docs/http/ngx_http_limit_req_module.html#limit_req_zone
+// Syntax:	limit_req_zone key zone=name:size rate=rate;.
+// The zone keeps the states up to its size, the least recently used ones are evicted when full.
+// The states are kept by the reloads, unless the size or the rate of the zone changes.
+type LimitReqZone struct {
+	Name string
+	Key  Template
+	// Rate is the requests per 1000 seconds, like 10r/s as 10000.
+	Rate int64
+	Size int64
+
+	*limitReqStates
+}
+
+// limitReqStates are the states of a zone, shared by the zones of the same name, size and rate
+// registered again by the reloads.
+type limitReqStates struct {
+	lock   sync.Mutex
+	states map[string]*list.Element
+	lru    *list.List
+}
+
+type limitReqState struct {
+	key string
+	// excess is the requests in the bucket, in the units of 1/1000 request.
+	excess int64
+	last   time.Time
+}
+
+var (
+	limitReqZonesLock sync.RWMutex
+	limitReqZones     = map[string]*LimitReqZone{}
+)
+
+// RegisterLimitReqZone parses and registers the limit_req_zone directive parameters.
+func RegisterLimitReqZone(params []string) error {
+	if len(params) < 3 {
+		return fmt.Errorf("limit_req_zone requires a key, a zone and a rate: %w", ErrSyntax)
+	}
+
+	z := &LimitReqZone{Key: ParseTemplate(params[0])}
+
+	for _, p := range params[1:] {
+		switch {
+		case strings.HasPrefix(p, "zone="):
+			name, size, ok := strings.Cut(p[5:], ":")
+			if !ok || name == "" {
+				return fmt.Errorf("invalid zone %q: %w", p, ErrSyntax)
+			}
+
+			n, err := util.ParseSize(size)
+			if err != nil || n < limitReqStateSize {
+				return fmt.Errorf("invalid zone size %q: %w", p, ErrSyntax)
+			}
+
+			z.Name, z.Size = name, n
+		case strings.HasPrefix(p, "rate="):
+			rate, err := parseRate(p[5:])
+			if err != nil {
+				return err
+			}
+
+			z.Rate = rate
+		case p == "sync":
+		default:
+			return fmt.Errorf("invalid parameter %q: %w", p, ErrSyntax)
+		}
+	}
+
+	if z.Name == "" || z.Rate == 0 {
+		return fmt.Errorf("limit_req_zone requires zone= and rate=: %w", ErrSyntax)
+	}
+
+	limitReqZonesLock.Lock()
+	defer limitReqZonesLock.Unlock()
+
+	if old := limitReqZones[z.Name]; old != nil && old.Size == z.Size && old.Rate == z.Rate {
+		z.limitReqStates = old.limitReqStates
+	} else {
+		z.limitReqStates = &limitReqStates{states: make(map[string]*list.Element), lru: list.New()}
+	}
+
+	limitReqZones[z.Name] = z
+
+	return nil
+}
+
+// parseRate parses the rate like 10r/s and 30r/m, in the requests per 1000 seconds.
+func parseRate(s string) (int64, error) {
+	n, unit, ok := strings.Cut(s, "r/")
+	scale := int64(1)
+
+	switch unit {
+	case "s":
+	case "m":
+		scale = 60
+	default:
+		ok = false
+	}
+
+	rate, err := strconv.ParseInt(n, 10, 64)
+	if !ok || err != nil || rate <= 0 {
+		return 0, fmt.Errorf("invalid rate %q: %w", s, ErrSyntax)
+	}
+
+	return rate * 1000 / scale, nil
+}
+
+func findLimitReqZone(name string) *LimitReqZone {
+	limitReqZonesLock.RLock()
+	defer limitReqZonesLock.RUnlock()
+
+	return limitReqZones[name]
+}
+
+// lookup computes the excess of the request in the bucket of the key by the leaky bucket algorithm,
+// false if the excess is beyond the burst. The state is kept as is, until commit after all the limits pass.
+func (z *LimitReqZone) lookup(key string, now time.Time, burst int64) (excess int64, ok bool) {
+	z.lock.Lock()
+	defer z.lock.Unlock()
+
+	e, found := z.states[key]
+	if !found {
+		return 0, true
+	}
+
+	s := e.Value.(*limitReqState)
+
+	excess = s.excess - z.Rate*now.Sub(s.last).Milliseconds()/1000 + 1000
+	if excess < 0 {
+		excess = 0
+	}
+
+	return excess, excess <= burst
+}
+
+// commit records the excess of the request passed in the bucket of the key,
+// the least recently used state is evicted when the zone is full.
+func (z *LimitReqZone) commit(key string, now time.Time, excess int64) {
+	z.lock.Lock()
+	defer z.lock.Unlock()
+
+	if e, found := z.states[key]; found {
+		z.lru.MoveToFront(e)
+		s := e.Value.(*limitReqState)
+		s.excess, s.last = excess, now
+
+		return
+	}
+
+	if z.lru.Len() >= int(z.Size/limitReqStateSize) {
+		oldest := z.lru.Back()
+		delete(z.states, oldest.Value.(*limitReqState).key)
+		z.lru.Remove(oldest)
+	}
+
+	z.states[key] = z.lru.PushFront(&limitReqState{key: key, excess: excess, last: now})
+}
+
+type limitReqNaming struct{}
+
+func (i limitReqNaming) Create() Processor {
+	return &limitReq{limitReqNaming: i, Status: http.StatusServiceUnavailable, LogLevel: util.LevelError}
+}
+
+func (limitReqNaming) Name() map[string]bool {
+	return map[string]bool{
+		"limit_req":           true,
+		"limit_req_status":    true,
+		"limit_req_log_level": true,
+		"limit_req_dry_run":   true,
+	}
+}
+
+// limitReq means http://nginx.org/en/docs/http/ngx_http_limit_req_module.html.
+// Syntax:	limit_req zone=name [burst=number] [nodelay | delay=number];.
+// Syntax:	limit_req_status code;.
+// Syntax:	limit_req_log_level info | notice | warn | error;.
+// Syntax:	limit_req_dry_run on | off;.
+// The requests beyond the rate are delayed, up to the burst, and rejected beyond it.
+// With several limits, the request is accounted in the zones only when all of them pass, like nginx.
+// The requests in the dry run are accounted but not limited, and $limit_req_status tells the result.
+type limitReq struct {
+	limitReqNaming
+
+	Limits   []limitReqRule
+	Status   int
+	LogLevel util.Level
+	DryRun   bool
+}
+
+type limitReqRule struct {
+	Zone *LimitReqZone
+	// Burst and Delay are in the units of 1/1000 request, Delay is -1 for nodelay.
+	Burst int64
+	Delay int64
+}
+
+func (a *limitReq) GetProcessSeq() ProcessSeq { return Preaccess }
+
+func (a *limitReq) Parse(path string, name string, params []string) error {
+	if name == "limit_req" {
+		return a.parseLimit(params)
+	}
+
+	if len(params) != 1 {
+		return ErrSyntax
+	}
+
+	switch name {
+	case "limit_req_status":
+		code, err := strconv.Atoi(params[0])
+		if err != nil || code < 400 || code > 599 {
+			return fmt.Errorf("value %s must be between 400 and 599", params[0])
+		}
+
+		a.Status = code
+	case "limit_req_log_level":
+		level, ok := util.ParseLevel(params[0])
+		if !ok || level < util.LevelInfo || level > util.LevelError {
+			return fmt.Errorf("invalid log level %s", params[0])
+		}
+
+		a.LogLevel = level
+	case "limit_req_dry_run":
+		if params[0] != "on" && params[0] != "off" {
+			return ErrSyntax
+		}
+
+		a.DryRun = params[0] == "on"
+	}
+
+	return nil
+}
+
+func (a *limitReq) parseLimit(params []string) error {
+	var rule limitReqRule
+
+	for _, p := range params {
+		var err error
+
+		switch {
+		case strings.HasPrefix(p, "zone="):
+			if rule.Zone = findLimitReqZone(p[5:]); rule.Zone == nil {
+				return fmt.Errorf("unknown limit_req_zone \"%s\"", p[5:])
+			}
+		case strings.HasPrefix(p, "burst="):
+			rule.Burst, err = strconv.ParseInt(p[6:], 10, 64)
+			rule.Burst *= 1000
+		case strings.HasPrefix(p, "delay="):
+			rule.Delay, err = strconv.ParseInt(p[6:], 10, 64)
+			rule.Delay *= 1000
+		case p == "nodelay":
+			rule.Delay = -1
+		default:
+			return fmt.Errorf("invalid parameter %q: %w", p, ErrSyntax)
+		}
+
+		if err != nil || rule.Burst < 0 || rule.Delay < -1 {
+			return fmt.Errorf("invalid parameter %q: %w", p, ErrSyntax)
+		}
+	}
+
+	if rule.Zone == nil {
+		return fmt.Errorf("limit_req requires zone=: %w", ErrSyntax)
+	}
+
+	a.Limits = append(a.Limits, rule)
+
+	return nil
+}
+
+func (a *limitReq) Do(l Location, w http.ResponseWriter, r *http.Request) ProcessResult {
+	rc := GetRequestContext(r)
+
+	// the request is limited once, not again by the internal redirects or the subrequests.
+	if rc.LimitReqStatus != "" || rc.subrequest || len(a.Limits) == 0 {
+		return ProcessContinue
+	}
+
+	dryRun := ""
+	if a.DryRun {
+		dryRun = ", dry run"
+	}
+
+	now := time.Now()
+	el := ErrorLogOf(r)
+
+	var delay time.Duration
+
+	type passed struct {
+		zone   *LimitReqZone
+		key    string
+		excess int64
+	}
+
+	var passes []passed
+
+	for _, rule := range a.Limits {
+		key := rule.Zone.Key.Expand(r)
+		if key == "" {
+			continue
+		}
+
+		excess, ok := rule.Zone.lookup(key, now, rule.Burst)
+		if !ok {
+			el.Logf(a.LogLevel, "limiting requests%s, excess: %d.%03d by zone \"%s\"",
+				dryRun, excess/1000, excess%1000, rule.Zone.Name)
+
+			if a.DryRun {
+				rc.LimitReqStatus = "REJECTED_DRY_RUN"
+				return ProcessContinue
+			}
+
+			rc.LimitReqStatus = "REJECTED"
+			w.WriteHeader(a.Status)
+
+			return ProcessTerminate
+		}
+
+		passes = append(passes, passed{zone: rule.Zone, key: key, excess: excess})
+
+		if rule.Delay < 0 || excess <= rule.Delay {
+			continue
+		}
+
+		if d := time.Duration((excess-rule.Delay)*1000/rule.Zone.Rate) * time.Millisecond; d > delay {
+			delay = d
+			el.Logf(a.LogLevel-1, "delaying request%s, excess: %d.%03d, by zone \"%s\"",
+				dryRun, excess/1000, excess%1000, rule.Zone.Name)
+		}
+	}
+
+	for _, p := range passes {
+		p.zone.commit(p.key, now, p.excess)
+	}
+
+	switch {
+	case len(passes) == 0:
+		// the requests of the empty keys are not limited, like nginx.
+	case delay == 0:
+		rc.LimitReqStatus = "PASSED"
+	case a.DryRun:
+		rc.LimitReqStatus = "DELAYED_DRY_RUN"
+	default:
+		rc.LimitReqStatus = "DELAYED"
+
+		t := time.NewTimer(delay)
+		defer t.Stop()
+
+		select {
+		case <-t.C:
+		case <-r.Context().Done():
+			return ProcessTerminate
+		}
+	}
+
+	return ProcessContinue
+}
@@ -1,9 +1,9 @@
 package directive
 
 import (
-	"log"
 	"net/http"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/bingoohuang/gonginx/util"
@@ -12,7 +12,15 @@ import (
 type ProcessSeq int
 
 const (
-	Continue ProcessSeq = iota
+	// Prepare processors run ahead of the others, like the ones setting up the response headers.
+	Prepare ProcessSeq = iota
+	// Rewrite processors change the request URI ahead of the content processors, like rewrite.
+	Rewrite
+	// Preaccess processors limit the requests ahead of the access checks, like limit_req.
+	Preaccess
+	// Access processors check the access of the request, combined by satisfy, like allow and deny.
+	Access
+	Continue
 	Terminate
 )
 
@@ -24,6 +32,12 @@ type Processor interface {
 	Do(l Location, w http.ResponseWriter, r *http.Request) ProcessResult
 }
 
+// Ordered is the processor of a single directive, like rewrite and return of the rewrite module,
+// each of which is a processor of its own, run in the order defined instead of merged.
+type Ordered interface {
+	Ordered()
+}
+
 var factories = make([]ProcessorFactory, 0)
 
 // RegisterFactory registers a processor factory for a directive.
@@ -66,6 +80,8 @@ type Location struct {
 	Path       string
 	Processors Processors
 	Pattern    *regexp.Regexp
+	// Locations are the nested locations.
+	Locations Locations
 }
 
 func (l Location) Matches(p ModifierPriority, r *http.Request) bool {
@@ -87,12 +103,150 @@ func (l Location) Matches(p ModifierPriority, r *http.Request) bool {
 	}
 }
 
+// String returns the location definition, like "^~ /api".
+func (l Location) String() string {
+	if l.Modifier == "" {
+		return l.Path
+	}
+
+	return string(l.Modifier) + " " + l.Path
+}
+
+// Directives returns the directive names of the processors, like ["echo", "index|root|alias"].
+func (l Location) Directives() []string {
+	names := make([]string, 0, len(l.Processors))
+
+	for _, p := range l.Processors {
+		keys := make([]string, 0, 1)
+		for k := range p.Name() {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+		names = append(names, strings.Join(keys, "|"))
+	}
+
+	return names
+}
+
 func (l Location) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc := GetRequestContext(r)
+	rc.ifMatched, rc.rewriteStopped, rc.uriChanged = nil, false, false
+
+	l.serve(w, r, false)
+
+	if code := rc.Writer.Intercepted; code != 0 {
+		serveErrorPage(w, r, code)
+	}
+}
+
+// serve runs the processors of the location. Like nginx, the rewrite module directives run in order in the rewrite phase,
+// after which the location is searched again if the URI is changed, or the body of the last if matched serves
+// the request instead for the later phases, with its rewrite processors skipped, which have run when its condition matched.
+func (l Location) serve(w http.ResponseWriter, r *http.Request, rewritten bool) {
+	rc := GetRequestContext(r)
+	rc.Location = &l
+	accessChecked := false
+
 	for _, v := range l.Processors {
+		seq := v.GetProcessSeq()
+		if seq > Rewrite && !rewritten {
+			if rewritten = true; l.afterRewrite(w, r) {
+				return
+			}
+		}
+
+		// the content processors, like index inherited from the server level, work only when no response yet.
+		if rc.Writer.Status != 0 && seq == Terminate || rc.Writer.Intercepted != 0 {
+			return
+		}
+
+		if seq == Rewrite && (rewritten || rc.rewriteStopped) {
+			continue
+		}
+
+		// the access processors are checked all together at once.
+		if seq == Access {
+			if !accessChecked && !rc.subrequest {
+				if accessChecked = true; !l.checkAccess(w, r) {
+					return
+				}
+			}
+
+			continue
+		}
+
 		if v.Do(l, w, r) == ProcessTerminate {
+			return
+		}
+	}
+
+	if !rewritten {
+		l.afterRewrite(w, r)
+	}
+}
+
+// afterRewrite ends the rewrite phase, true if the request is served by the location searched again for the URI changed,
+// or by the body of the last if matched.
+func (l Location) afterRewrite(w http.ResponseWriter, r *http.Request) bool {
+	rc := GetRequestContext(r)
+
+	switch {
+	case rc.uriChanged:
+		rc.uriChanged = false
+		InternalRedirect(w, r, r.URL.RequestURI())
+	case rc.ifMatched != nil:
+		body := *rc.ifMatched
+		body.Seq = l.Seq
+		body.serve(w, r, true)
+	default:
+		return false
+	}
+
+	return true
+}
+
+// Rewrite runs the rewrite processors only, for the server level rewrite phase ahead of the location matching,
+// true if the response is finished, like by a redirect.
+func (l Location) Rewrite(w http.ResponseWriter, r *http.Request) bool {
+	rc := GetRequestContext(r)
+
+	for _, v := range l.Processors {
+		if rc.rewriteStopped {
 			break
 		}
+
+		if v.GetProcessSeq() == Rewrite && v.Do(l, w, r) == ProcessTerminate {
+			return true
+		}
 	}
+
+	return false
+}
+
+// Logger is the processor working in the log phase, after the response is sent.
+type Logger interface {
+	Log(l Location, r *http.Request)
+}
+
+// Log runs the log phase of the processors.
+func (l Location) Log(r *http.Request) {
+	for _, v := range l.Processors {
+		if lg, ok := v.(Logger); ok {
+			lg.Log(l, r)
+		}
+	}
+}
+
+// HasFactory tells whether the directive is supported by any processor.
+func HasFactory(directive string) bool {
+	for _, v := range factories {
+		if v.Name()[directive] {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (l *Location) createProcessor(firstWord string) Processor {
@@ -117,48 +271,138 @@ func (l *Location) findProcessor(firstWord string) Processor {
 
 func (l *Location) Parse(directive string, params []string) bool {
 	dp := l.findProcessor(directive)
-	if dp == nil {
-		dp = l.createProcessor(directive)
-		if dp != nil {
-			l.Processors = append(l.Processors, dp)
-		} else {
+	_, ordered := dp.(Ordered)
+
+	if dp == nil || ordered {
+		if dp = l.createProcessor(directive); dp == nil {
 			return false
 		}
+
+		if _, ordered = dp.(Ordered); !ordered {
+			l.Processors = append(l.Processors, dp)
+		}
 	}
 
 	if err := dp.Parse(l.Path, directive, params); err != nil {
-		log.Printf("F! invalid conf for %v error %+v", params, err)
+		util.Errorf("invalid conf for %v error %+v", params, err)
 		return false
 	}
 
+	// the ordered ones are added once parsed, the ones failed are dropped, like the rewrite of an invalid regex.
+	if ordered {
+		l.Processors = append(l.Processors, dp)
+	}
+
 	return true
 }
 
+// FindLocation finds the location serving the request, nil if none matched.
 func (ls Locations) FindLocation(r *http.Request) *Location {
-	path := r.URL.Path
+	l, _ := ls.find(r.URL.Path, nil)
+	return l
+}
 
-	for _, l := range ls {
-		switch l.Priority {
-		case ModifierExactly:
-			if l.Path == path {
-				return &l
-			}
-		case ModifierForward:
-			if path == l.Path || strings.HasPrefix(path, util.TryAppend(l.Path, "/")) {
-				return &l
+// LocationCandidate is a location checked to find the one serving the request.
+type LocationCandidate struct {
+	Location Location
+	Matched  bool
+	Reason   string
+}
+
+// ExplainLocation finds the location like FindLocation, and returns the locations checked with the reasons too.
+func (ls Locations) ExplainLocation(r *http.Request) (*Location, []LocationCandidate) {
+	candidates := make([]LocationCandidate, 0, len(ls))
+	l, _ := ls.find(r.URL.Path, &candidates)
+
+	return l, candidates
+}
+
+// find finds the location like nginx, http://nginx.org/en/docs/http/ngx_http_core_module.html#location.
+// The exact location is checked first, then the longest prefix location, whose nested locations are searched
+// in the same way, then the regular expression locations in order, unless the longest prefix location is ^~.
+// final tells the searching is halted, otherwise the location found is a prefix one,
+// which gives way to the regular expression locations of the outer levels.
+func (ls Locations) find(path string, candidates *[]LocationCandidate) (l *Location, final bool) {
+	check := func(l *Location) bool {
+		ok, reason := l.matchPath(path)
+		if candidates != nil {
+			*candidates = append(*candidates, LocationCandidate{Location: *l, Matched: ok, Reason: reason})
+		}
+
+		return ok
+	}
+
+	for i := range ls {
+		if ls[i].Priority == ModifierExactly && check(&ls[i]) {
+			return &ls[i], true
+		}
+	}
+
+	var prefix *Location
+
+	for i := range ls {
+		if p := ls[i].Priority; (p == ModifierForward || p == ModifierNone) && check(&ls[i]) {
+			if prefix == nil || len(ls[i].Path) > len(prefix.Path) {
+				prefix = &ls[i]
 			}
-		case ModifierRegular:
-			if l.Pattern.FindString(path) != "" {
-				return &l
+		}
+	}
+
+	found := prefix
+
+	if prefix != nil {
+		if nested, final := prefix.Locations.find(path, candidates); nested != nil {
+			if final {
+				return nested, true
 			}
-		case ModifierNone:
-			if strings.HasPrefix(path, l.Path) {
-				return &l
+
+			found = nested
+		}
+
+		if prefix.Priority == ModifierForward {
+			return found, true
+		}
+	}
+
+	for i := range ls {
+		if ls[i].Priority == ModifierRegular && check(&ls[i]) {
+			if nested, _ := ls[i].Locations.find(path, candidates); nested != nil {
+				return nested, true
 			}
+
+			return &ls[i], true
 		}
 	}
 
-	return nil
+	return found, false
+}
+
+// matchPath tells whether the location matches the path, and why.
+func (l Location) matchPath(path string) (bool, string) {
+	switch l.Priority {
+	case ModifierExactly:
+		if l.Path == path {
+			return true, "the path equals " + l.Path
+		}
+		return false, "the path is not exactly " + l.Path
+	case ModifierForward:
+		if path == l.Path || strings.HasPrefix(path, util.TryAppend(l.Path, "/")) {
+			return true, "the path starts with " + l.Path
+		}
+		return false, "the path does not start with " + util.TryAppend(l.Path, "/")
+	case ModifierRegular:
+		if l.Pattern.FindString(path) != "" {
+			return true, "the path matches the regular expression " + l.Pattern.String()
+		}
+		return false, "the path does not match the regular expression " + l.Pattern.String()
+	case ModifierNone:
+		if strings.HasPrefix(path, l.Path) {
+			return true, "the path starts with the prefix " + l.Path
+		}
+		return false, "the path does not start with the prefix " + l.Path
+	}
+
+	return false, "unknown modifier " + string(l.Modifier)
 }
 
 type Locations []Location
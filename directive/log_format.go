@@ -0,0 +1,224 @@
+package directive
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogFormat is the format of the access log.
+// http://nginx.org/en/docs/http/ngx_http_log_module.html#log_format
+// Syntax: log_format name [escape=default|json|none] string ...;
+type LogFormat struct {
+	Name     string
+	Escape   string
+	Template Template
+	// Native means the predefined json format, which writes one JSON object per request.
+	Native bool
+}
+
+// CombinedFormat is the predefined combined format.
+const CombinedFormat = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`
+
+// Logs are the log formats and the access log files of a configuration.
+// The log_format and access_log directives parsed after NewLogs belong to it, until the next NewLogs,
+// and its files are closed by Close when the configuration is replaced, e.g. by a reload.
+type Logs struct {
+	lock    sync.RWMutex
+	formats map[string]*LogFormat
+	files   []*logFile
+}
+
+var (
+	parsingLogsLock sync.RWMutex
+	// parsingLogs are the logs of the configuration being parsed.
+	parsingLogs = newLogs()
+)
+
+// NewLogs creates the logs of the configuration to be parsed, with the predefined formats.
+func NewLogs() *Logs {
+	logs := newLogs()
+
+	parsingLogsLock.Lock()
+	parsingLogs = logs
+	parsingLogsLock.Unlock()
+
+	return logs
+}
+
+func newLogs() *Logs {
+	return &Logs{formats: map[string]*LogFormat{
+		"combined": {Name: "combined", Escape: "default", Template: ParseTemplate(CombinedFormat)},
+		"json":     {Name: "json", Escape: "json", Native: true},
+	}}
+}
+
+func currentLogs() *Logs {
+	parsingLogsLock.RLock()
+	defer parsingLogsLock.RUnlock()
+
+	return parsingLogs
+}
+
+// RegisterLogFormat parses and registers the log_format directive parameters.
+func (l *Logs) RegisterLogFormat(params []string) error {
+	if len(params) < 2 {
+		return fmt.Errorf("log_format requires a name and a format: %w", ErrSyntax)
+	}
+
+	f := &LogFormat{Name: params[0], Escape: "default"}
+	params = params[1:]
+
+	if strings.HasPrefix(params[0], "escape=") {
+		f.Escape = strings.TrimPrefix(params[0], "escape=")
+		params = params[1:]
+
+		switch f.Escape {
+		case "default", "json", "none":
+		default:
+			return fmt.Errorf("invalid log_format escape %q: %w", f.Escape, ErrSyntax)
+		}
+	}
+
+	if len(params) == 0 {
+		return fmt.Errorf("log_format %s requires a format: %w", f.Name, ErrSyntax)
+	}
+
+	f.Template = ParseTemplate(strings.Join(params, ""))
+
+	l.lock.Lock()
+	l.formats[f.Name] = f
+	l.lock.Unlock()
+
+	return nil
+}
+
+func (l *Logs) findLogFormat(name string) *LogFormat {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return l.formats[name]
+}
+
+// Format formats the log line for the request.
+func (f *LogFormat) Format(r *http.Request) string {
+	if f.Native {
+		return formatJSON(r)
+	}
+
+	switch f.Escape {
+	case "json":
+		return f.Template.ExpandFunc(r, escapeJSON)
+	case "none":
+		return f.Template.Expand(r)
+	default:
+		return f.Template.ExpandFunc(r, escapeDefault)
+	}
+}
+
+// escapeDefault escapes ", \ and the characters out of the printable ASCII as \xXX,
+// and shows the empty value as -.
+func escapeDefault(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '"' || c == '\\' || c < 32 || c > 126 {
+			_, _ = fmt.Fprintf(&b, "\\x%02X", c)
+			continue
+		}
+
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
+
+// escapeJSON escapes the value to be embedded in a JSON string.
+func escapeJSON(s string) string {
+	var b strings.Builder
+
+	for _, c := range s {
+		switch c {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 32 {
+				_, _ = fmt.Fprintf(&b, `\u%04x`, c)
+				continue
+			}
+
+			b.WriteRune(c)
+		}
+	}
+
+	return b.String()
+}
+
+// jsonLog is the access log in the native json format.
+type jsonLog struct {
+	Time                 string  `json:"time"`
+	RemoteAddr           string  `json:"remote_addr"`
+	RemoteUser           string  `json:"remote_user,omitempty"`
+	Method               string  `json:"request_method"`
+	URI                  string  `json:"request_uri"`
+	Protocol             string  `json:"server_protocol"`
+	Status               int     `json:"status"`
+	BodyBytesSent        int64   `json:"body_bytes_sent"`
+	BytesSent            int64   `json:"bytes_sent"`
+	RequestTime          float64 `json:"request_time"`
+	ServerName           string  `json:"server_name"`
+	Location             string  `json:"location,omitempty"`
+	UpstreamAddr         string  `json:"upstream_addr,omitempty"`
+	UpstreamStatus       int     `json:"upstream_status,omitempty"`
+	UpstreamResponseTime float64 `json:"upstream_response_time,omitempty"`
+	Referer              string  `json:"http_referer,omitempty"`
+	UserAgent            string  `json:"http_user_agent,omitempty"`
+}
+
+func formatJSON(r *http.Request) string {
+	rc := GetRequestContext(r)
+	v := func(name string) string { s, _ := Variable(name, r); return s }
+
+	l := jsonLog{
+		Time:           v("time_iso8601"),
+		RemoteAddr:     v("remote_addr"),
+		RemoteUser:     v("remote_user"),
+		Method:         r.Method,
+		URI:            r.RequestURI,
+		Protocol:       r.Proto,
+		Status:         rc.Writer.Status,
+		BodyBytesSent:  rc.Writer.BodyBytes,
+		BytesSent:      rc.Writer.HeaderBytes + rc.Writer.BodyBytes,
+		RequestTime:    time.Since(rc.Start).Seconds(),
+		ServerName:     rc.ServerName,
+		Location:       v("location"),
+		UpstreamAddr:   rc.UpstreamAddr,
+		UpstreamStatus: rc.UpstreamStatus,
+		Referer:        r.Referer(),
+		UserAgent:      r.UserAgent(),
+	}
+
+	if rc.UpstreamAddr != "" {
+		l.UpstreamResponseTime = rc.UpstreamResponseTime.Seconds()
+	}
+
+	b, _ := json.Marshal(l)
+
+	return string(b)
+}
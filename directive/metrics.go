@@ -0,0 +1,270 @@
+package directive
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterFactory(&metricsNaming{})
+}
+
+type metricsNaming struct{}
+
+func (i metricsNaming) Create() Processor {
+	return &metricsExporter{metricsNaming: i}
+}
+
+func (metricsNaming) Name() map[string]bool {
+	return map[string]bool{
+		"metrics": true,
+	}
+}
+
+// metricsExporter is not in nginx, it exports the metrics in the Prometheus text format.
+// Syntax: metrics;, like location = /metrics { metrics; }.
+type metricsExporter struct {
+	metricsNaming
+}
+
+func (m *metricsExporter) Parse(path string, name string, params []string) error { return nil }
+
+func (m *metricsExporter) GetProcessSeq() ProcessSeq { return Terminate }
+
+func (m *metricsExporter) Do(l Location, w http.ResponseWriter, r *http.Request) ProcessResult {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	Metrics.Export(w)
+
+	return ProcessTerminate
+}
+
+// durationBuckets are the upper bounds in seconds of the latency histograms.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	counts []int64
+	count  int64
+	sum    float64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	if h.counts == nil {
+		h.counts = make([]int64, len(durationBuckets))
+	}
+
+	v := d.Seconds()
+	for i, le := range durationBuckets {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+
+	h.count++
+	h.sum += v
+}
+
+// statusClasses counts the responses by the status class, 1xx to 5xx.
+type statusClasses [5]int64
+
+func (s *statusClasses) add(status int) {
+	if status == 0 {
+		// the response without any writing is 200.
+		status = http.StatusOK
+	}
+
+	if i := status/100 - 1; i >= 0 && i < len(s) {
+		s[i]++
+	}
+}
+
+type locationKey struct {
+	server, location string
+}
+
+type locationMetrics struct {
+	statuses statusClasses
+	duration histogram
+}
+
+type upstreamMetrics struct {
+	statuses statusClasses
+	failures int64
+	up       bool
+	duration histogram
+}
+
+// Metrics collects the request metrics of the locations and the upstreams.
+var Metrics = &metricsRegistry{
+	locations: make(map[locationKey]*locationMetrics),
+	upstreams: make(map[string]*upstreamMetrics),
+}
+
+type metricsRegistry struct {
+	lock      sync.Mutex
+	locations map[locationKey]*locationMetrics
+	upstreams map[string]*upstreamMetrics
+}
+
+// Observe records the metrics of the request when it is finished.
+func (m *metricsRegistry) Observe(r *http.Request) {
+	rc := GetRequestContext(r)
+
+	key := locationKey{server: rc.ServerName}
+	if rc.Location != nil {
+		key.location = rc.Location.String()
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	lm, ok := m.locations[key]
+	if !ok {
+		lm = &locationMetrics{}
+		m.locations[key] = lm
+	}
+
+	lm.statuses.add(rc.Writer.Status)
+	lm.duration.observe(time.Since(rc.Start))
+
+	if rc.UpstreamAddr == "" {
+		return
+	}
+
+	um, ok := m.upstreams[rc.UpstreamAddr]
+	if !ok {
+		um = &upstreamMetrics{}
+		m.upstreams[rc.UpstreamAddr] = um
+	}
+
+	um.up = rc.UpstreamError == nil
+	if !um.up {
+		um.failures++
+		return
+	}
+
+	um.statuses.add(rc.UpstreamStatus)
+	um.duration.observe(rc.UpstreamResponseTime)
+}
+
+// Export writes the metrics in the Prometheus text format.
+// https://prometheus.io/docs/instrumenting/exposition_formats/
+func (m *metricsRegistry) Export(w io.Writer) {
+	b := bufio.NewWriter(w)
+	defer b.Flush()
+
+	c := Connections.Snapshot()
+	writeMetric(b, "gonginx_connections_active", "gauge", "The active client connections.", c.Active)
+	writeMetric(b, "gonginx_connections_reading", "gauge", "The connections reading the request.", c.Reading)
+	writeMetric(b, "gonginx_connections_writing", "gauge", "The connections serving the request.", c.Writing)
+	writeMetric(b, "gonginx_connections_waiting", "gauge", "The idle keep-alive connections.", c.Waiting)
+	writeMetric(b, "gonginx_connections_accepted_total", "counter", "The accepted client connections.", c.Accepted)
+	writeMetric(b, "gonginx_connections_handled_total", "counter", "The handled client connections.", c.Handled)
+	writeMetric(b, "gonginx_http_requests_total", "counter", "The client requests.", c.Requests)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	keys := make([]locationKey, 0, len(m.locations))
+	for k := range m.locations {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].server != keys[j].server {
+			return keys[i].server < keys[j].server
+		}
+		return keys[i].location < keys[j].location
+	})
+
+	labels := make([]string, len(keys))
+	for i, k := range keys {
+		labels[i] = fmt.Sprintf(`server="%s",location="%s"`, escapeLabel(k.server), escapeLabel(k.location))
+	}
+
+	name := "gonginx_http_location_requests_total"
+	writeHelp(b, name, "counter", "The requests by the server, location and status class.")
+	for i, k := range keys {
+		writeStatuses(b, name, labels[i], m.locations[k].statuses)
+	}
+
+	name = "gonginx_http_location_request_duration_seconds"
+	writeHelp(b, name, "histogram", "The request latencies by the server and location.")
+	for i, k := range keys {
+		writeHistogram(b, name, labels[i], m.locations[k].duration)
+	}
+
+	upstreams := make([]string, 0, len(m.upstreams))
+	for u := range m.upstreams {
+		upstreams = append(upstreams, u)
+	}
+
+	sort.Strings(upstreams)
+
+	writeHelp(b, "gonginx_upstream_up", "gauge", "Whether the last request to the upstream succeeded.")
+	for _, u := range upstreams {
+		up := 0
+		if m.upstreams[u].up {
+			up = 1
+		}
+		fmt.Fprintf(b, "gonginx_upstream_up{upstream=\"%s\"} %d\n", escapeLabel(u), up)
+	}
+
+	writeHelp(b, "gonginx_upstream_failures_total", "counter", "The failures to connect or read the upstream.")
+	for _, u := range upstreams {
+		fmt.Fprintf(b, "gonginx_upstream_failures_total{upstream=\"%s\"} %d\n", escapeLabel(u), m.upstreams[u].failures)
+	}
+
+	name = "gonginx_upstream_responses_total"
+	writeHelp(b, name, "counter", "The upstream responses by the status class.")
+	for _, u := range upstreams {
+		writeStatuses(b, name, fmt.Sprintf(`upstream="%s"`, escapeLabel(u)), m.upstreams[u].statuses)
+	}
+
+	name = "gonginx_upstream_response_duration_seconds"
+	writeHelp(b, name, "histogram", "The upstream response latencies.")
+	for _, u := range upstreams {
+		writeHistogram(b, name, fmt.Sprintf(`upstream="%s"`, escapeLabel(u)), m.upstreams[u].duration)
+	}
+}
+
+func writeHelp(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeMetric(w io.Writer, name, typ, help string, v int64) {
+	writeHelp(w, name, typ, help)
+	fmt.Fprintf(w, "%s %d\n", name, v)
+}
+
+func writeStatuses(w io.Writer, name, labels string, s statusClasses) {
+	for i, n := range s {
+		if n > 0 {
+			fmt.Fprintf(w, "%s{%s,code=\"%dxx\"} %d\n", name, labels, i+1, n)
+		}
+	}
+}
+
+func writeHistogram(w io.Writer, name, labels string, h histogram) {
+	for i, le := range durationBuckets {
+		var n int64
+		if h.counts != nil {
+			n = h.counts[i]
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, strconv.FormatFloat(le, 'g', -1, 64), n)
+	}
+
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+	fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
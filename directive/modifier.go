@@ -1,6 +1,10 @@
 package directive
 
-import "github.com/pkg/errors"
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
 
 // ModifierPriority defines the priority of the modifier.
 // https://end0tknr.wordpress.com/2015/12/22/location-match-priority-in-nginx/.
@@ -26,23 +30,28 @@ const (
 	ModifierRegular
 	// ModifierNone means none modifier for the location.
 	ModifierNone
+	// ModifierNamed like location @fallback, which is used only by the internal redirects.
+	ModifierNamed
 )
 
 // Modifier is the location modifier.
 type Modifier string
 
-// Priority returns the priority of the location matching.
-func (m Modifier) Priority() ModifierPriority {
+// Priority returns the priority of the location matching, the path is used to tell the named location.
+func (m Modifier) Priority(path string) (ModifierPriority, error) {
 	switch m {
 	case "=":
-		return ModifierExactly
+		return ModifierExactly, nil
 	case "^~":
-		return ModifierForward
+		return ModifierForward, nil
 	case "~", "~*":
-		return ModifierRegular
+		return ModifierRegular, nil
 	case "":
-		return ModifierNone
+		if strings.HasPrefix(path, "@") {
+			return ModifierNamed, nil
+		}
+		return ModifierNone, nil
 	default:
-		panic(errors.Wrapf(ErrSyntax, "unsupported modifier %s", m))
+		return 0, errors.Wrapf(ErrSyntax, "unsupported modifier %s", m)
 	}
 }
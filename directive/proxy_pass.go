@@ -1,7 +1,6 @@
 package directive
 
 import (
-	"log"
 	"net/http"
 	"net/url"
 	"path/filepath"
@@ -45,7 +44,9 @@ func (r *proxyPass) Parse(path string, name string, params []string) error {
 	proxyPass := params[0]
 	proxyPath, err := url.Parse(proxyPass)
 	if err != nil {
-		log.Printf("F! failed to parse proxy_pass %v", proxyPass)
+		util.Errorf("failed to parse proxy_pass %v", proxyPass)
+	} else {
+		Upstreams.Register(proxyPath.Host)
 	}
 
 	r.URL = proxyPath
@@ -64,7 +65,45 @@ func (r *proxyPass) Do(l Location, w http.ResponseWriter, rq *http.Request) Proc
 
 	targetPath := util.TryPrepend(filepath.Join(r.URL.Path, proxyPath), "/")
 	p := gonet.ReverseProxy(rq.URL.Path, r.URL.Host, targetPath, 10*time.Second)
+
+	rc := GetRequestContext(rq)
+	rc.UpstreamAddr = r.URL.Host
+
+	if err := Upstreams.start(r.URL.Host); err != nil {
+		rc.UpstreamError = err
+		ErrorLogOf(rq).Errorf("%v while connecting to upstream %s", err, r.URL.Host)
+		w.WriteHeader(http.StatusBadGateway)
+
+		return ProcessTerminate
+	}
+
+	defer func() { Upstreams.done(r.URL.Host, rc.UpstreamError) }()
+
+	ErrorLogOf(rq).Debugf("proxy to %s%s", r.URL.Host, targetPath)
+	start := time.Now()
+
+	director := p.Director
+	p.Director = func(out *http.Request) {
+		director(out)
+		setProxyHeaders(l, rq, out)
+	}
+
+	modifyResponse := p.ModifyResponse
+	p.ModifyResponse = func(rsp *http.Response) error {
+		rc.UpstreamStatus = rsp.StatusCode
+		rc.UpstreamHeader = rsp.Header
+
+		return modifyResponse(rsp)
+	}
+	p.ErrorHandler = func(w http.ResponseWriter, rq *http.Request, err error) {
+		rc.UpstreamStatus = http.StatusBadGateway
+		rc.UpstreamError = err
+		ErrorLogOf(rq).Errorf("proxy_pass %s error: %v", r.URL.Host, err)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
 	p.ServeHTTP(w, rq)
+	rc.UpstreamResponseTime = time.Since(start)
 
 	return ProcessTerminate
 }
@@ -0,0 +1,74 @@
+package directive
+
+import (
+	"net/http"
+)
+
+func init() {
+	RegisterFactory(&proxySetHeaderNaming{})
+}
+
+type proxySetHeaderNaming struct{}
+
+func (i proxySetHeaderNaming) Create() Processor {
+	return &proxySetHeader{proxySetHeaderNaming: i}
+}
+
+func (proxySetHeaderNaming) Name() map[string]bool {
+	return map[string]bool{"proxy_set_header": true}
+}
+
+// proxySetHeader means http://nginx.org/en/docs/http/ngx_http_proxy_module.html#proxy_set_header.
+// Syntax:	proxy_set_header field value;.
+// The fields of the request passed by proxy_pass are set to the values, which may contain variables,
+// e.g. the ones of auth_request_set, and the fields of the empty values are not passed.
+type proxySetHeader struct {
+	proxySetHeaderNaming
+
+	Fields []proxyHeaderField
+}
+
+type proxyHeaderField struct {
+	Name  string
+	Value Template
+}
+
+func (p *proxySetHeader) GetProcessSeq() ProcessSeq { return Prepare }
+
+func (p *proxySetHeader) Parse(path string, name string, params []string) error {
+	if len(params) != 2 {
+		return ErrSyntax
+	}
+
+	p.Fields = append(p.Fields, proxyHeaderField{Name: http.CanonicalHeaderKey(params[0]), Value: ParseTemplate(params[1])})
+
+	return nil
+}
+
+func (p *proxySetHeader) Do(Location, http.ResponseWriter, *http.Request) ProcessResult {
+	return ProcessContinue
+}
+
+// setProxyHeaders sets the fields of proxy_set_header in the location l to the request out to the upstream,
+// the values are evaluated for the request r.
+func setProxyHeaders(l Location, r, out *http.Request) {
+	for _, dp := range l.Processors {
+		p, ok := dp.(*proxySetHeader)
+		if !ok {
+			continue
+		}
+
+		for _, f := range p.Fields {
+			v := f.Value.Expand(r)
+
+			switch {
+			case v == "":
+				out.Header.Del(f.Name)
+			case f.Name == "Host":
+				out.Host = v
+			default:
+				out.Header.Set(f.Name, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package directive
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxInternalRedirects limits the internal redirects of a request, like nginx.
+const maxInternalRedirects = 10
+
+// InternalRedirect serves the request by the location matching the uri, or by the named location like @fallback,
+// like the nginx internal redirects for try_files, error_page and so on.
+// The request URI is changed in place, so $uri tells the redirected one, while $request_uri keeps the original.
+func InternalRedirect(w http.ResponseWriter, r *http.Request, uri string) ProcessResult {
+	rc := GetRequestContext(r)
+
+	if rc.Redirects++; rc.Redirects > maxInternalRedirects {
+		ErrorLogOf(r).Errorf("rewrite or internal redirection cycle while internally redirecting to \"%s\"", uri)
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return ProcessTerminate
+	}
+
+	var l *Location
+
+	if strings.HasPrefix(uri, "@") {
+		if l = rc.Named[uri]; l == nil {
+			ErrorLogOf(r).Errorf("could not find named location \"%s\"", uri)
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return ProcessTerminate
+		}
+	} else {
+		u, err := url.Parse(uri)
+		if err != nil {
+			ErrorLogOf(r).Errorf("invalid internal redirect \"%s\": %v", uri, err)
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return ProcessTerminate
+		}
+
+		r.URL.Path, r.URL.RawPath, r.URL.RawQuery = u.Path, "", u.RawQuery
+
+		if l = rc.Locations.FindLocation(r); l == nil {
+			w.WriteHeader(http.StatusNotFound)
+
+			return ProcessTerminate
+		}
+	}
+
+	ErrorLogOf(r).Debugf("internal redirect: \"%s\", using configuration \"%s\"", uri, l)
+	l.ServeHTTP(w, r)
+
+	return ProcessTerminate
+}
@@ -3,8 +3,8 @@ package directive
 import (
 	"fmt"
 	"net/http"
-
-	"github.com/bingoohuang/gou/str"
+	"strconv"
+	"strings"
 )
 
 func init() {
@@ -23,35 +23,107 @@ func (returnNaming) Name() map[string]bool {
 	}
 }
 
+// StatusCloseConnection is the nginx special code 444, closing the connection without a response.
+const StatusCloseConnection = 444
+
 // Return means http://nginx.org/en/docs/http/ngx_http_rewrite_module.html#return.
-// Syntax:	return code [text];.
+// Syntax:	return code [text]; return code URL; return URL;.
+// The text and URL may contain variables, the URL alone redirects by 302,
+// and the redirect codes 301, 302, 303, 307 and 308 take the text as the URL.
+// It stops processing the location, and the server level one stops ahead of the location matching.
+// Each return is a processor of its own, the first one reached in order serves the request.
 type Return struct {
 	returnNaming
 
 	Code int
-	Text string
+	Text Template
 }
 
+func (*Return) Ordered() {}
+
 func (r *Return) GetProcessSeq() ProcessSeq {
-	return Terminate
+	return Rewrite
 }
 
 func (r *Return) Do(l Location, w http.ResponseWriter, rq *http.Request) ProcessResult {
+	if r.Code == StatusCloseConnection {
+		closeConnection(w, rq)
+
+		return ProcessTerminate
+	}
+
+	text := r.Text.Expand(rq)
+
+	if isRedirectCode(r.Code) {
+		w.Header().Set("Location", text)
+		w.WriteHeader(r.Code)
+
+		return ProcessTerminate
+	}
+
 	w.WriteHeader(r.Code)
 
-	if r.Text != "" {
-		_, _ = fmt.Fprint(w, r.Text)
+	if text != "" {
+		_, _ = fmt.Fprint(w, text)
 	}
 
-	return ProcessContinue
+	return ProcessTerminate
 }
 
 func (r *Return) Parse(path string, name string, params []string) error {
-	r.Code = str.ParseInt(params[0])
+	if len(params) == 0 || len(params) > 2 {
+		return ErrSyntax
+	}
+
+	code, err := strconv.Atoi(params[0])
+
+	switch {
+	case err == nil && len(params) == 2:
+		r.Code, r.Text = code, ParseTemplate(params[1])
+	case err == nil:
+		r.Code = code
+	case len(params) == 1 && isRedirectURL(params[0]):
+		r.Code, r.Text = http.StatusFound, ParseTemplate(params[0])
+	default:
+		return fmt.Errorf("invalid return code %s", params[0])
+	}
 
-	if len(params) > 1 {
-		r.Text = params[1]
+	if r.Code < 0 || r.Code > 999 {
+		return fmt.Errorf("invalid return code %d", r.Code)
 	}
 
 	return nil
 }
+
+func isRedirectCode(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+
+	return false
+}
+
+func isRedirectURL(s string) bool {
+	return isAbsoluteURL(s) || strings.HasPrefix(s, "$scheme")
+}
+
+// closeConnection closes the client connection without any response, like nginx 444.
+func closeConnection(w http.ResponseWriter, r *http.Request) {
+	rc := GetRequestContext(r)
+	rc.Writer.Status = StatusCloseConnection
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return
+	}
+
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		ErrorLogOf(r).Errorf("close connection for 444 failed: %v", err)
+		return
+	}
+
+	_ = conn.Close()
+}
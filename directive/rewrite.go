@@ -0,0 +1,205 @@
+package directive
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bingoohuang/gonginx/util"
+)
+
+func init() {
+	RegisterFactory(&rewriteNaming{})
+	RegisterFactory(&rewriteLogNaming{})
+}
+
+type rewriteNaming struct{}
+
+func (i rewriteNaming) Create() Processor {
+	return &rewrite{rewriteNaming: i}
+}
+
+func (rewriteNaming) Name() map[string]bool {
+	return map[string]bool{"rewrite": true}
+}
+
+// rewrite means http://nginx.org/en/docs/http/ngx_http_rewrite_module.html#rewrite.
+// Syntax:	rewrite regex replacement [last|break|redirect|permanent];.
+// Each rewrite is a processor of its own, run in the order defined with the other rewrite module directives,
+// the captures $1..$9 and the named ones are available to the replacement and the later directives.
+// The location is searched again for the URI changed after all of them run, or at once by last,
+// and break stops them without searching. At the server level, the rewrites run ahead of the location matching.
+// The regexes are PCRE ones, see CompileRegex, the rules failed to compile are dropped with a warning.
+type rewrite struct {
+	rewriteNaming
+
+	Regex       *util.PCRE
+	Replacement Template
+	Flag        string
+}
+
+func (*rewrite) Ordered() {}
+
+// CompileRegex compiles the regex of rewrite and if by PCRE like nginx, with the named captures (?<name>...) or (?'name'...).
+// Unlike the regexp package, the backreferences like \1 and the lookarounds like (?!...) are supported.
+func CompileRegex(expr string) (*util.PCRE, error) {
+	re, err := util.CompilePCRE(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %q: %w", expr, err)
+	}
+
+	return re, nil
+}
+
+func (p *rewrite) GetProcessSeq() ProcessSeq { return Rewrite }
+
+func (p *rewrite) Parse(path string, name string, params []string) error {
+	if len(params) < 2 || len(params) > 3 {
+		return ErrSyntax
+	}
+
+	p.Replacement = ParseTemplate(params[1])
+	if len(params) == 3 {
+		switch p.Flag = params[2]; p.Flag {
+		case "last", "break", "redirect", "permanent":
+		default:
+			return fmt.Errorf("invalid rewrite flag %s", p.Flag)
+		}
+	}
+
+	re, err := CompileRegex(params[0])
+	if err != nil {
+		util.Warnf("rewrite %s dropped: %v", params[0], err)
+		return err
+	}
+
+	p.Regex = re
+
+	return nil
+}
+
+func (p *rewrite) Do(l Location, w http.ResponseWriter, r *http.Request) ProcessResult {
+	rc := GetRequestContext(r)
+	el := ErrorLogOf(r)
+	log := rewriteLogOn(l)
+
+	matches := p.Regex.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		if log {
+			el.Logf(util.LevelNotice, "\"%s\" does not match \"%s\"", p.Regex, r.URL.Path)
+		}
+
+		return ProcessContinue
+	}
+
+	if log {
+		el.Logf(util.LevelNotice, "\"%s\" matches \"%s\"", p.Regex, r.URL.Path)
+	}
+
+	rc.setCaptures(matches, p.Regex)
+	uri := p.Replacement.Expand(r)
+
+	if p.Flag == "redirect" || p.Flag == "permanent" || isAbsoluteURL(uri) {
+		return p.redirect(w, r, uri, log)
+	}
+
+	path, args, hasArgs := strings.Cut(uri, "?")
+
+	// the original arguments are appended, unless the replacement ends with a question mark.
+	switch {
+	case !hasArgs:
+		args = r.URL.RawQuery
+	case args != "" && r.URL.RawQuery != "":
+		args += "&" + r.URL.RawQuery
+	}
+
+	r.URL.Path, r.URL.RawPath, r.URL.RawQuery = path, "", args
+	rc.uriChanged = true
+
+	if log {
+		el.Logf(util.LevelNotice, "rewritten data: \"%s\", args: \"%s\"", path, args)
+	}
+
+	switch p.Flag {
+	case "break":
+		rc.rewriteStopped, rc.uriChanged = true, false
+	case "last":
+		rc.rewriteStopped = true
+	}
+
+	return ProcessContinue
+}
+
+func (p *rewrite) redirect(w http.ResponseWriter, r *http.Request, uri string, log bool) ProcessResult {
+	if strings.HasSuffix(uri, "?") {
+		uri = strings.TrimSuffix(uri, "?")
+	} else if r.URL.RawQuery != "" {
+		if strings.Contains(uri, "?") {
+			uri += "&" + r.URL.RawQuery
+		} else {
+			uri += "?" + r.URL.RawQuery
+		}
+	}
+
+	code := http.StatusFound
+	if p.Flag == "permanent" {
+		code = http.StatusMovedPermanently
+	}
+
+	if log {
+		ErrorLogOf(r).Logf(util.LevelNotice, "rewritten redirect: \"%s\"", uri)
+	}
+
+	http.Redirect(w, r, uri, code)
+
+	return ProcessTerminate
+}
+
+func isAbsoluteURL(uri string) bool {
+	return strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://")
+}
+
+type rewriteLogNaming struct{}
+
+func (i rewriteLogNaming) Create() Processor {
+	return &rewriteLog{rewriteLogNaming: i}
+}
+
+func (rewriteLogNaming) Name() map[string]bool {
+	return map[string]bool{"rewrite_log": true}
+}
+
+// rewriteLog means http://nginx.org/en/docs/http/ngx_http_rewrite_module.html#rewrite_log.
+// Syntax:	rewrite_log on | off;.
+// The results of the rewrites in the location are logged at the notice level.
+type rewriteLog struct {
+	rewriteLogNaming
+
+	On bool
+}
+
+func (p *rewriteLog) GetProcessSeq() ProcessSeq { return Prepare }
+
+func (p *rewriteLog) Parse(path string, name string, params []string) error {
+	if len(params) != 1 || params[0] != "on" && params[0] != "off" {
+		return ErrSyntax
+	}
+
+	p.On = params[0] == "on"
+
+	return nil
+}
+
+func (p *rewriteLog) Do(Location, http.ResponseWriter, *http.Request) ProcessResult {
+	return ProcessContinue
+}
+
+func rewriteLogOn(l Location) bool {
+	for _, p := range l.Processors {
+		if lg, ok := p.(*rewriteLog); ok {
+			return lg.On
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,56 @@
+package directive
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+func init() {
+	RegisterFactory(&setNaming{})
+}
+
+type setNaming struct{}
+
+func (i setNaming) Create() Processor {
+	return &set{setNaming: i}
+}
+
+func (setNaming) Name() map[string]bool {
+	return map[string]bool{"set": true}
+}
+
+// set means http://nginx.org/en/docs/http/ngx_http_rewrite_module.html#set.
+// Syntax:	set $variable value;.
+// Each set is a processor of its own, run in the order defined with the other rewrite module directives.
+type set struct {
+	setNaming
+
+	Variable string
+	Value    Template
+}
+
+func (*set) Ordered() {}
+
+func (s *set) GetProcessSeq() ProcessSeq { return Rewrite }
+
+func (s *set) Parse(path string, name string, params []string) error {
+	if len(params) != 2 || !strings.HasPrefix(params[0], "$") || len(params[0]) == 1 {
+		return fmt.Errorf("invalid variable %v: %w", params, ErrSyntax)
+	}
+
+	s.Variable, s.Value = params[0][1:], ParseTemplate(params[1])
+
+	return nil
+}
+
+func (s *set) Do(l Location, w http.ResponseWriter, r *http.Request) ProcessResult {
+	rc := GetRequestContext(r)
+	if rc.Vars == nil {
+		rc.Vars = make(map[string]string)
+	}
+
+	rc.Vars[s.Variable] = s.Value.Expand(r)
+
+	return ProcessContinue
+}
@@ -0,0 +1,129 @@
+package directive
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+func init() {
+	RegisterFactory(&stubStatusNaming{})
+}
+
+type stubStatusNaming struct{}
+
+func (i stubStatusNaming) Create() Processor {
+	return &stubStatus{stubStatusNaming: i}
+}
+
+func (stubStatusNaming) Name() map[string]bool {
+	return map[string]bool{
+		"stub_status": true,
+	}
+}
+
+// stubStatus means http://nginx.org/en/docs/http/ngx_http_stub_status_module.html#stub_status
+type stubStatus struct {
+	stubStatusNaming
+}
+
+func (s *stubStatus) Parse(path string, name string, params []string) error { return nil }
+
+func (s *stubStatus) GetProcessSeq() ProcessSeq { return Terminate }
+
+func (s *stubStatus) Do(l Location, w http.ResponseWriter, r *http.Request) ProcessResult {
+	c := Connections.Snapshot()
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = fmt.Fprintf(w, "Active connections: %d \nserver accepts handled requests\n %d %d %d \n"+
+		"Reading: %d Writing: %d Waiting: %d \n",
+		c.Active, c.Accepted, c.Handled, c.Requests, c.Reading, c.Writing, c.Waiting)
+
+	return ProcessTerminate
+}
+
+// ConnectionStats is the snapshot of the connection statistics.
+type ConnectionStats struct {
+	Active, Reading, Writing, Waiting int64
+	Accepted, Handled, Requests       int64
+}
+
+// Connections counts the client connections and the requests of all the servers.
+var Connections = &connectionCounter{states: make(map[net.Conn]http.ConnState)}
+
+type connectionCounter struct {
+	lock   sync.Mutex
+	states map[net.Conn]http.ConnState
+
+	accepted, requests int64
+}
+
+// ConnState tracks the state of the connection, used as http.Server.ConnState.
+// The connections waiting for the first request are reading, the ones serving requests are writing,
+// and the idle keep-alive ones are waiting.
+func (c *connectionCounter) ConnState(conn net.Conn, state http.ConnState) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	switch state {
+	case http.StateNew:
+		c.accepted++
+		c.states[conn] = state
+	case http.StateActive, http.StateIdle:
+		c.states[conn] = state
+	default:
+		delete(c.states, conn)
+	}
+}
+
+// AddRequest counts a request.
+func (c *connectionCounter) AddRequest() { atomic.AddInt64(&c.requests, 1) }
+
+// Snapshot returns the current statistics.
+func (c *connectionCounter) Snapshot() ConnectionStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	s := ConnectionStats{
+		Active:   int64(len(c.states)),
+		Accepted: c.accepted,
+		// the accepted connections are always handled, unless some resource limits have been reached in nginx.
+		Handled:  c.accepted,
+		Requests: atomic.LoadInt64(&c.requests),
+	}
+
+	for _, state := range c.states {
+		switch state {
+		case http.StateNew:
+			s.Reading++
+		case http.StateActive:
+			s.Writing++
+		case http.StateIdle:
+			s.Waiting++
+		}
+	}
+
+	return s
+}
+
+// connectionVariable evaluates the $connections_* variables of the stub_status module.
+func connectionVariable(name string) (string, bool) {
+	s := Connections.Snapshot()
+
+	switch name {
+	case "connections_active":
+		return strconv.FormatInt(s.Active, 10), true
+	case "connections_reading":
+		return strconv.FormatInt(s.Reading, 10), true
+	case "connections_writing":
+		return strconv.FormatInt(s.Writing, 10), true
+	case "connections_waiting":
+		return strconv.FormatInt(s.Waiting, 10), true
+	}
+
+	return "", false
+}
@@ -0,0 +1,122 @@
+package directive
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	RegisterFactory(&tryFilesNaming{})
+}
+
+type tryFilesNaming struct{}
+
+func (i tryFilesNaming) Create() Processor {
+	return &tryFiles{tryFilesNaming: i}
+}
+
+func (tryFilesNaming) Name() map[string]bool {
+	return map[string]bool{
+		"try_files": true,
+	}
+}
+
+// tryFiles means http://nginx.org/en/docs/http/ngx_http_core_module.html#try_files.
+// Syntax:	try_files file ... uri; try_files file ... =code;.
+// The files are checked by the root or alias, a name ending with a slash checks a directory.
+// The first one existing is served by changing the request URI to it,
+// otherwise the request is internally redirected to the last uri or named location, or responded with the code.
+type tryFiles struct {
+	tryFilesNaming
+
+	Files    []Template
+	Fallback Template
+	Code     int
+}
+
+// GetProcessSeq runs ahead of the content processors, like index serving the file found.
+func (t *tryFiles) GetProcessSeq() ProcessSeq { return Continue }
+
+func (t *tryFiles) Parse(path string, name string, params []string) error {
+	if len(params) < 2 {
+		return ErrSyntax
+	}
+
+	for _, p := range params[:len(params)-1] {
+		t.Files = append(t.Files, ParseTemplate(p))
+	}
+
+	last := params[len(params)-1]
+	if code := strings.TrimPrefix(last, "="); code != last {
+		c, err := strconv.Atoi(code)
+		if err != nil || c < 100 || c > 999 {
+			return ErrSyntax
+		}
+
+		t.Code = c
+	} else {
+		t.Fallback = ParseTemplate(last)
+	}
+
+	return nil
+}
+
+func (t *tryFiles) Do(l Location, w http.ResponseWriter, r *http.Request) ProcessResult {
+	i, ok := documentRoot(l)
+
+	for _, f := range t.Files {
+		uri := f.Expand(r)
+		dir := strings.HasSuffix(uri, "/")
+
+		name := i.filename(l, uri)
+
+		ErrorLogOf(r).Debugf("trying to use \"%s\" \"%s\"", uri, name)
+
+		if fi, err := os.Stat(name); err == nil && fi.IsDir() == dir {
+			r.URL.Path, r.URL.RawPath = uri, ""
+
+			if !ok && !dir {
+				// no index, root or alias in the location to serve the file.
+				http.ServeFile(w, r, name)
+
+				return ProcessTerminate
+			}
+
+			return ProcessContinue
+		}
+	}
+
+	if t.Code != 0 {
+		w.WriteHeader(t.Code)
+
+		return ProcessTerminate
+	}
+
+	return InternalRedirect(w, r, t.Fallback.Expand(r))
+}
+
+// documentRoot returns the index, root and alias of the location, the root defaults to the working directory.
+func documentRoot(l Location) (index, bool) {
+	for _, p := range l.Processors {
+		if i, ok := p.(*index); ok {
+			return *i, true
+		}
+	}
+
+	return index{}, false
+}
+
+// filename returns the file of the uri by the root or alias of the location.
+func (i index) filename(l Location, uri string) string {
+	switch {
+	case i.Alias != "":
+		return filepath.Join(i.Alias, strings.TrimPrefix(uri, l.Path))
+	case i.Root != "":
+		return filepath.Join(i.Root, uri)
+	default:
+		return strings.TrimPrefix(uri, "/")
+	}
+}
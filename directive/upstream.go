@@ -0,0 +1,105 @@
+package directive
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ErrNoLiveUpstreams means all the upstream servers are drained or unavailable.
+var ErrNoLiveUpstreams = errors.New("no live upstreams")
+
+// UpstreamMember is the state of an upstream server proxied to.
+type UpstreamMember struct {
+	Addr string `json:"addr"`
+	// Drained upstream servers receive no new requests, until enabled again.
+	Drained   bool   `json:"drained"`
+	Active    int64  `json:"active"`
+	Requests  int64  `json:"requests"`
+	Failures  int64  `json:"failures"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Upstreams holds the upstream servers proxied to, their states are kept across reloads.
+var Upstreams = &upstreamRegistry{members: make(map[string]*UpstreamMember)}
+
+type upstreamRegistry struct {
+	lock    sync.Mutex
+	members map[string]*UpstreamMember
+}
+
+func (u *upstreamRegistry) member(addr string) *UpstreamMember {
+	m, ok := u.members[addr]
+	if !ok {
+		m = &UpstreamMember{Addr: addr}
+		u.members[addr] = m
+	}
+
+	return m
+}
+
+// Register registers the upstream server, e.g. when proxy_pass is parsed.
+func (u *upstreamRegistry) Register(addr string) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	u.member(addr)
+}
+
+// List returns the states of the upstream servers, sorted by the address.
+func (u *upstreamRegistry) List() []UpstreamMember {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	members := make([]UpstreamMember, 0, len(u.members))
+	for _, m := range u.members {
+		members = append(members, *m)
+	}
+
+	sort.Slice(members, func(i, j int) bool { return members[i].Addr < members[j].Addr })
+
+	return members
+}
+
+// SetDrained drains or enables the upstream server, false if it is unknown.
+func (u *upstreamRegistry) SetDrained(addr string, drained bool) bool {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	m, ok := u.members[addr]
+	if ok {
+		m.Drained = drained
+	}
+
+	return ok
+}
+
+// start counts a request to the upstream server, ErrNoLiveUpstreams if it is drained.
+func (u *upstreamRegistry) start(addr string) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	m := u.member(addr)
+	if m.Drained {
+		return ErrNoLiveUpstreams
+	}
+
+	m.Active++
+	m.Requests++
+
+	return nil
+}
+
+// done counts the request to the upstream server finished with the error.
+func (u *upstreamRegistry) done(addr string, err error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	m := u.member(addr)
+	m.Active--
+
+	if err != nil {
+		m.Failures++
+		m.LastError = err.Error()
+	}
+}
@@ -0,0 +1,301 @@
+package directive
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Variable evaluates the nginx variable of the request, the name is without the leading $.
+// http://nginx.org/en/docs/varindex.html
+func Variable(name string, r *http.Request) (string, bool) {
+	rc := GetRequestContext(r)
+
+	switch name {
+	case "remote_addr":
+		return remoteHost(r), true
+	case "binary_remote_addr":
+		// the 4 or 16 bytes of the address, like nginx, e.g. for the keys of limit_req_zone.
+		if addr, err := netip.ParseAddr(remoteHost(r)); err == nil {
+			return string(addr.Unmap().AsSlice()), true
+		}
+		return remoteHost(r), true
+	case "remote_port":
+		_, p, _ := net.SplitHostPort(r.RemoteAddr)
+		return p, true
+	case "remote_user":
+		u, _, _ := r.BasicAuth()
+		return u, true
+	case "time_local":
+		return time.Now().Format("02/Jan/2006:15:04:05 -0700"), true
+	case "time_iso8601":
+		return time.Now().Format("2006-01-02T15:04:05-07:00"), true
+	case "msec":
+		now := time.Now()
+		return fmt.Sprintf("%d.%03d", now.Unix(), now.Nanosecond()/1e6), true
+	case "request":
+		return fmt.Sprintf("%s %s %s", r.Method, r.RequestURI, r.Proto), true
+	case "request_method":
+		return r.Method, true
+	case "request_uri":
+		return r.RequestURI, true
+	case "uri", "document_uri":
+		return r.URL.Path, true
+	case "document_root", "request_filename":
+		if rc.Location == nil {
+			return "", true
+		}
+		i, _ := documentRoot(*rc.Location)
+		if name == "document_root" {
+			return i.Root, true
+		}
+		return i.filename(*rc.Location, r.URL.Path), true
+	case "args", "query_string":
+		return r.URL.RawQuery, true
+	case "is_args":
+		if r.URL.RawQuery != "" {
+			return "?", true
+		}
+		return "", true
+	case "server_protocol":
+		return r.Proto, true
+	case "scheme":
+		if r.TLS != nil {
+			return "https", true
+		}
+		return "http", true
+	case "https":
+		if r.TLS != nil {
+			return "on", true
+		}
+		return "", true
+	case "host":
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if host == "" {
+			host = rc.ServerName
+		}
+		return strings.ToLower(host), true
+	case "server_name":
+		return rc.ServerName, true
+	case "server_addr", "server_port":
+		addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+		if !ok {
+			return "", true
+		}
+		h, p, _ := net.SplitHostPort(addr.String())
+		if name == "server_addr" {
+			return h, true
+		}
+		return p, true
+	case "content_type":
+		return r.Header.Get("Content-Type"), true
+	case "content_length":
+		return r.Header.Get("Content-Length"), true
+	case "status":
+		if rc.Writer.Status == 0 {
+			return "000", true
+		}
+		return strconv.Itoa(rc.Writer.Status), true
+	case "body_bytes_sent":
+		return strconv.FormatInt(rc.Writer.BodyBytes, 10), true
+	case "bytes_sent":
+		return strconv.FormatInt(rc.Writer.HeaderBytes+rc.Writer.BodyBytes, 10), true
+	case "request_length":
+		return strconv.FormatInt(rc.RequestLength(), 10), true
+	case "request_time":
+		return formatSeconds(time.Since(rc.Start)), true
+	case "pid":
+		return strconv.Itoa(os.Getpid()), true
+	case "location":
+		// not in nginx, the location matched, like "^~ /api".
+		if rc.Location == nil {
+			return "", true
+		}
+		return rc.Location.String(), true
+	case "limit_req_status":
+		return rc.LimitReqStatus, true
+	case "upstream_addr":
+		return rc.UpstreamAddr, true
+	case "upstream_status":
+		if rc.UpstreamStatus == 0 {
+			return "", true
+		}
+		return strconv.Itoa(rc.UpstreamStatus), true
+	case "upstream_response_time":
+		if rc.UpstreamAddr == "" {
+			return "", true
+		}
+		return formatSeconds(rc.UpstreamResponseTime), true
+	}
+
+	if len(name) == 1 && name[0] >= '0' && name[0] <= '9' {
+		return rc.Captures[name], true
+	}
+
+	switch {
+	case strings.HasPrefix(name, "connections_"):
+		return connectionVariable(name)
+	case strings.HasPrefix(name, "http_"):
+		return r.Header.Get(headerName(name[5:])), true
+	case strings.HasPrefix(name, "sent_http_"):
+		return rc.Writer.Header().Get(headerName(name[10:])), true
+	case strings.HasPrefix(name, "upstream_http_"):
+		return rc.UpstreamHeader.Get(headerName(name[14:])), true
+	case strings.HasPrefix(name, "arg_"):
+		return r.URL.Query().Get(name[4:]), true
+	case strings.HasPrefix(name, "jwt_claim_"):
+		return rc.jwtValue(name[10:], false), true
+	case strings.HasPrefix(name, "jwt_header_"):
+		return rc.jwtValue(name[11:], true), true
+	case strings.HasPrefix(name, "cookie_"):
+		if c, err := r.Cookie(name[7:]); err == nil {
+			return c.Value, true
+		}
+		return "", true
+	}
+
+	if v, ok := rc.Captures[name]; ok {
+		return v, true
+	}
+
+	if v, ok := rc.Vars[name]; ok {
+		return v, true
+	}
+
+	return "", false
+}
+
+// remoteHost returns the host of the client address, without the port.
+func remoteHost(r *http.Request) string {
+	if h, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return h
+	}
+
+	return r.RemoteAddr
+}
+
+// formatSeconds formats the duration in seconds with a milliseconds resolution, like 0.012.
+func formatSeconds(d time.Duration) string {
+	return fmt.Sprintf("%d.%03d", d/time.Second, d%time.Second/time.Millisecond)
+}
+
+// headerName converts the variable suffix like user_agent to the header name User-Agent.
+func headerName(s string) string {
+	return strings.ReplaceAll(s, "_", "-")
+}
+
+// Template is a text with embedded nginx variables, like "$remote_addr [$time_local]" or "${uri}x".
+type Template struct {
+	parts []templatePart
+}
+
+type templatePart struct {
+	text     string
+	variable bool
+}
+
+// ParseTemplate parses the text with variables.
+func ParseTemplate(s string) Template {
+	var t Template
+
+	literal := strings.Builder{}
+	flushLiteral := func() {
+		if literal.Len() > 0 {
+			t.parts = append(t.parts, templatePart{text: literal.String()})
+			literal.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 >= len(s) {
+			literal.WriteByte(s[i])
+			continue
+		}
+
+		if s[i+1] == '{' {
+			if end := strings.IndexByte(s[i+2:], '}'); end > 0 {
+				flushLiteral()
+				t.parts = append(t.parts, templatePart{text: s[i+2 : i+2+end], variable: true})
+				i += 2 + end
+				continue
+			}
+		}
+
+		j := i + 1
+		if s[j] >= '0' && s[j] <= '9' {
+			// the captures like $1 are single digits.
+			j++
+		} else {
+			for j < len(s) && isVariableChar(s[j]) {
+				j++
+			}
+		}
+
+		if j == i+1 {
+			literal.WriteByte(s[i])
+			continue
+		}
+
+		flushLiteral()
+		t.parts = append(t.parts, templatePart{text: s[i+1 : j], variable: true})
+		i = j - 1
+	}
+
+	flushLiteral()
+
+	return t
+}
+
+func isVariableChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+// HasVariable tells whether the template contains any variable.
+func (t Template) HasVariable() bool {
+	for _, p := range t.parts {
+		if p.variable {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Expand evaluates the template for the request, the unknown variables are kept as is.
+func (t Template) Expand(r *http.Request) string {
+	return t.ExpandFunc(r, nil)
+}
+
+// ExpandFunc evaluates the template like Expand, with the variable values converted by fn if not nil.
+func (t Template) ExpandFunc(r *http.Request, fn func(string) string) string {
+	var b strings.Builder
+
+	for _, p := range t.parts {
+		if !p.variable {
+			b.WriteString(p.text)
+			continue
+		}
+
+		v, ok := Variable(p.text, r)
+		if !ok {
+			b.WriteString("$" + p.text)
+			continue
+		}
+
+		if fn != nil {
+			v = fn(v)
+		}
+
+		b.WriteString(v)
+	}
+
+	return b.String()
+}
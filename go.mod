@@ -8,7 +8,10 @@ require (
 	github.com/bingoohuang/gonet v0.0.0-20230804022419-67aac8effd70
 	github.com/bingoohuang/gou v0.0.0-20210727012756-4873089fc9df
 	github.com/pkg/errors v0.9.1
+	github.com/sirupsen/logrus v1.9.3
 	go.elara.ws/pcre v0.0.0-20230805032557-4ce849193f64
+	golang.org/x/crypto v0.15.0
+	modernc.org/libc v1.16.8
 )
 
 require (
@@ -25,12 +28,10 @@ require (
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/remyoudompheng/bigfft v0.0.0-20200410134404-eec4a21b6bb0 // indirect
-	github.com/sirupsen/logrus v1.9.3 // indirect
 	github.com/thoas/go-funk v0.9.0 // indirect
 	golang.org/x/net v0.15.0 // indirect
-	golang.org/x/sys v0.12.0 // indirect
-	golang.org/x/term v0.12.0 // indirect
-	modernc.org/libc v1.16.8 // indirect
+	golang.org/x/sys v0.14.0 // indirect
+	golang.org/x/term v0.14.0 // indirect
 	modernc.org/mathutil v1.4.1 // indirect
 	modernc.org/memory v1.1.1 // indirect
 )
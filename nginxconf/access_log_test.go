@@ -0,0 +1,229 @@
+package nginxconf_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/gonginx/directive"
+	"github.com/bingoohuang/gonginx/nginxconf"
+)
+
+func parseServers(t *testing.T, conf string) []nginxconf.NginxServer {
+	block, err := nginxconf.Parse([]byte(conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return block.ParseServers()
+}
+
+func TestAccessLog(t *testing.T) {
+	dir := t.TempDir()
+	httpLog := filepath.Join(dir, "http.log")
+	locationLog := filepath.Join(dir, "location.log")
+
+	servers := parseServers(t, fmt.Sprintf(`
+http {
+    log_format short '$request_method $uri $status $body_bytes_sent "$http_x_missing"';
+    access_log %s short;
+
+    server {
+        listen 15001;
+        location /hello { echo hello; }
+        location /quiet { access_log off; echo quiet; }
+        location /only {
+            access_log %s combined if=$arg_log;
+            echo only;
+        }
+    }
+}`, httpLog, locationLog))
+
+	for _, uri := range []string{"/hello", "/quiet", "/only?log=1", "/only"} {
+		req := httptest.NewRequest("GET", uri, nil)
+		req.Header.Set("User-Agent", "tester")
+		servers[0].ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	directive.FlushLogs()
+
+	if s := readFile(t, httpLog); s != "GET /hello 200 6 \"-\"\n" {
+		t.Errorf("unexpected http level log %q", s)
+	}
+
+	s := readFile(t, locationLog)
+	if strings.Count(s, "\n") != 1 || !strings.Contains(s, `"GET /only?log=1 HTTP/1.1" 200 5 "-" "tester"`) {
+		t.Errorf("unexpected location level log %q", s)
+	}
+}
+
+func readFile(t *testing.T, name string) string {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+func TestJSONAccessLog(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, "created")
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	nativeLog := filepath.Join(dir, "native.log")
+	escapedLog := filepath.Join(dir, "escaped.log")
+
+	servers := parseServers(t, fmt.Sprintf(`
+http {
+    log_format escaped escape=json '{"uri":"$uri","upstream":"$upstream_addr","upstream_status":"$upstream_status"}';
+    server {
+        listen 15001;
+        server_name api.local;
+        location ^~ /api {
+            access_log %s json;
+            access_log %s escaped;
+            proxy_pass %s;
+        }
+    }
+}`, nativeLog, escapedLog, backend.URL))
+
+	servers[0].ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", `/api/a"b`, nil))
+	directive.FlushLogs()
+
+	var native map[string]interface{}
+	if err := json.Unmarshal([]byte(readFile(t, nativeLog)), &native); err != nil {
+		t.Fatal(err)
+	}
+
+	upstream := strings.TrimPrefix(backend.URL, "http://")
+	expected := map[string]interface{}{
+		"request_method":  "POST",
+		"status":          float64(201),
+		"body_bytes_sent": float64(7),
+		"server_name":     "api.local",
+		"location":        "^~ /api",
+		"upstream_addr":   upstream,
+		"upstream_status": float64(201),
+	}
+
+	for k, v := range expected {
+		if native[k] != v {
+			t.Errorf("unexpected %s: %v, expected %v", k, native[k], v)
+		}
+	}
+
+	if _, ok := native["upstream_response_time"]; !ok {
+		t.Error("upstream_response_time expected")
+	}
+
+	var escaped map[string]string
+	if err := json.Unmarshal([]byte(readFile(t, escapedLog)), &escaped); err != nil {
+		t.Fatal(err)
+	}
+
+	if escaped["uri"] != `/api/a"b` || escaped["upstream"] != upstream || escaped["upstream_status"] != "201" {
+		t.Errorf("unexpected escaped log %v", escaped)
+	}
+}
+
+func TestRequestVariables(t *testing.T) {
+	tests := []struct {
+		remote, body string
+		chunked      bool
+		binary       []byte
+	}{
+		{remote: "10.1.2.3:1234", binary: []byte{10, 1, 2, 3}},
+		{remote: "[2001:db8::1]:1234", body: "hello", binary: net.ParseIP("2001:db8::1")},
+		{remote: "[::ffff:10.1.2.3]:1234", body: "chunked body", chunked: true, binary: []byte{10, 1, 2, 3}},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/upload?x=1", strings.NewReader(tt.body))
+		r.RemoteAddr = tt.remote
+		r.Header.Set("X-Test", "1")
+
+		if tt.chunked {
+			r.ContentLength = -1
+		}
+
+		_, r = directive.StartRequest(httptest.NewRecorder(), r, "")
+		_, _ = io.ReadAll(r.Body)
+
+		if v, _ := directive.Variable("binary_remote_addr", r); v != string(tt.binary) {
+			t.Errorf("%s: expected binary_remote_addr %v, got %v", tt.remote, tt.binary, []byte(v))
+		}
+
+		// POST /upload?x=1 HTTP/1.1, Host: example.com, X-Test: 1, the empty line and the body.
+		expected := len("POST /upload?x=1 HTTP/1.1\r\n") + len("Host: example.com\r\n") + len("X-Test: 1\r\n") + 2 + len(tt.body)
+		if v, _ := directive.Variable("request_length", r); v != strconv.Itoa(expected) {
+			t.Errorf("%s: expected request_length %d, got %s", tt.remote, expected, v)
+		}
+	}
+}
+
+func TestAccessLogReload(t *testing.T) {
+	dir := t.TempDir()
+	aLog, bLog := filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log")
+	port := freePort(t)
+
+	s := startServers(t, fmt.Sprintf(`
+http {
+    log_format short 'one $uri';
+    server {
+        listen %d;
+        location / {
+            access_log %s short buffer=64k flush=1h;
+            access_log %s short;
+            echo ok;
+        }
+    }
+}`, port, aLog, bLog))
+	defer s.Close()
+
+	get := func(uri string) {
+		rsp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d%s", port, uri))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _ = io.Copy(io.Discard, rsp.Body)
+		rsp.Body.Close()
+	}
+
+	get("/1")
+
+	// the buffer of a.log changes and b.log is removed, both are flushed and closed by the reload.
+	s.Reload(parseServers(t, fmt.Sprintf(`
+http {
+    log_format short 'two $uri';
+    server {
+        listen %d;
+        location / { access_log %s short; echo ok; }
+    }
+}`, port, aLog)))
+
+	if a, b := readFile(t, aLog), readFile(t, bLog); a != "one /1\n" || b != "one /1\n" {
+		t.Errorf("expected the logs flushed by the reload, got %q and %q", a, b)
+	}
+
+	// the formats of the configuration parsed but not loaded do not apply.
+	parseServers(t, `http { log_format short 'three $uri'; }`)
+	get("/2")
+	directive.FlushLogs()
+
+	if a, b := readFile(t, aLog), readFile(t, bLog); a != "one /1\ntwo /2\n" || b != "one /1\n" {
+		t.Errorf("expected the logs of the reloaded configuration, got %q and %q", a, b)
+	}
+}
@@ -0,0 +1,54 @@
+package nginxconf_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAllowDeny(t *testing.T) {
+	servers := parseServers(t, `
+server {
+    listen 15015;
+    deny 192.168.1.1;
+    allow 192.168.0.0/16;
+    allow 2001:db8::/32;
+    allow unix:;
+    deny all;
+    location /a { echo a; }
+    location /open { allow 10.0.0.1; echo open; }
+}`)
+
+	tests := []struct {
+		uri, remote string
+		unix        bool
+		status      int
+	}{
+		{uri: "/a", remote: "192.168.2.3:1234", status: 200},
+		{uri: "/a", remote: "192.168.1.1:1234", status: 403},
+		{uri: "/a", remote: "10.0.0.1:1234", status: 403},
+		{uri: "/a", remote: "[2001:db8::1]:1234", status: 200},
+		{uri: "/a", remote: "[::ffff:192.168.2.3]:1234", status: 200},
+		{uri: "/a", remote: "@", unix: true, status: 200},
+		{uri: "/open", remote: "10.0.0.2:1234", status: 200},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.uri, nil)
+		r.RemoteAddr = tt.remote
+
+		if tt.unix {
+			r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey,
+				&net.UnixAddr{Name: "/run/gonginx.sock", Net: "unix"}))
+		}
+
+		w := httptest.NewRecorder()
+		servers[0].ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("%s from %s: expected %d, got %d", tt.uri, tt.remote, tt.status, w.Code)
+		}
+	}
+}
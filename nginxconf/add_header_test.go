@@ -0,0 +1,88 @@
+package nginxconf_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAddHeader(t *testing.T) {
+	servers := parseServers(t, `
+http {
+    add_header X-Frame-Options DENY;
+    add_header Strict-Transport-Security "max-age=31536000" always;
+    server {
+        listen 15013;
+        add_header X-Server s;
+        error_page 404 /404;
+        location /a { echo a; }
+        location /b { add_header X-Location b; echo b; }
+        location /denied { return 403; }
+        location /missing { return 404; }
+        location = /404 { add_header X-Page 404 always; echo page; }
+        location /t { add_trailer X-Trailer $uri always; echo t; }
+    }
+}`)
+
+	tests := []struct {
+		uri     string
+		headers map[string]string
+	}{
+		{uri: "/a", headers: map[string]string{"X-Server": "s", "X-Frame-Options": ""}},
+		{uri: "/b", headers: map[string]string{"X-Location": "b", "X-Server": ""}},
+		{uri: "/denied", headers: map[string]string{"X-Server": ""}},
+		{uri: "/missing", headers: map[string]string{"X-Page": "404", "X-Server": ""}},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		servers[0].ServeHTTP(w, httptest.NewRequest("GET", tt.uri, nil))
+
+		for name, value := range tt.headers {
+			if got := w.Header().Get(name); got != value {
+				t.Errorf("%s: expected %s: %q, got %q", tt.uri, name, value, got)
+			}
+		}
+	}
+
+	servers = parseServers(t, `
+server {
+    listen 15014;
+    add_header Strict-Transport-Security "max-age=31536000" always;
+    add_header X-Frame-Options DENY;
+    rewrite ^/old$ /t permanent;
+    location /denied { return 403; }
+    location /t { add_trailer X-Trailer $uri; echo t; }
+}`)
+
+	// the redirect by the server level rewrite, ahead of the location matching.
+	w := httptest.NewRecorder()
+	servers[0].ServeHTTP(w, httptest.NewRequest("GET", "/old", nil))
+
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("X-Frame-Options") != "DENY" {
+		t.Errorf("unexpected %d headers of the redirect %v", w.Code, w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	servers[0].ServeHTTP(w, httptest.NewRequest("GET", "/denied", nil))
+
+	if w.Header().Get("Strict-Transport-Security") == "" || w.Header().Get("X-Frame-Options") != "" {
+		t.Errorf("unexpected headers of 403 %v", w.Header())
+	}
+
+	ts := httptest.NewServer(servers[0])
+	defer ts.Close()
+
+	rsp, err := http.Get(ts.URL + "/t")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+
+	if rsp.Trailer.Get("X-Trailer") != "/t" || rsp.Header.Get("X-Frame-Options") != "DENY" {
+		t.Errorf("unexpected header %v and trailer %v", rsp.Header, rsp.Trailer)
+	}
+}
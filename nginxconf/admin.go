@@ -0,0 +1,252 @@
+package nginxconf
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/gonginx/directive"
+	"github.com/bingoohuang/gonginx/util"
+)
+
+// Admin serves the runtime admin API in JSON, not in nginx, enabled by admin_listen.
+//
+//	GET  /status                      version, pid, uptime and the config file
+//	GET  /config                      the source of the configuration loaded
+//	GET  /servers                     the servers and locations by the listening port
+//	GET  /upstreams                   the upstream servers and their states
+//	POST /upstreams/{addr}/drain      stops sending new requests to the upstream server
+//	POST /upstreams/{addr}/enable     resumes the drained upstream server
+//	POST /reload                      reloads the configuration, like the HUP signal
+type Admin struct {
+	Servers    *RunningServers
+	ConfigFile string
+	Version    string
+	// Reload reloads the configuration.
+	Reload func() error
+	// Token is required in the Authorization: Bearer header if not empty.
+	Token string
+
+	started time.Time
+	lock    sync.RWMutex
+	config  []byte
+	server  *http.Server
+}
+
+// SetConfig records the source of the configuration loaded.
+func (a *Admin) SetConfig(source []byte) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.config = source
+}
+
+// Listen serves the admin API on the address, host:port or unix:/path,
+// the mode is the permissions of the unix socket file.
+func (a *Admin) Listen(addr string, mode os.FileMode) error {
+	if a.started.IsZero() {
+		a.started = time.Now()
+	}
+
+	var (
+		l   net.Listener
+		err error
+	)
+
+	if path := strings.TrimPrefix(addr, "unix:"); path != addr {
+		_ = os.Remove(path)
+
+		if l, err = net.Listen("unix", path); err != nil {
+			return err
+		}
+
+		if err = os.Chmod(path, mode); err != nil {
+			_ = l.Close()
+			return err
+		}
+	} else if l, err = net.Listen("tcp", addr); err != nil {
+		return err
+	}
+
+	if a.Token == "" && !strings.HasPrefix(addr, "unix:") {
+		util.Warnf("admin_listen %s without token=, anyone can access the admin API", addr)
+	}
+
+	a.server = &http.Server{Handler: a}
+	util.Infof("admin API listening on %s", addr)
+
+	go func() {
+		if err := a.server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			util.Errorf("admin API serve error: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// Close stops the admin API.
+func (a *Admin) Close() error {
+	if a.server == nil {
+		return nil
+	}
+
+	return a.server.Close()
+}
+
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if a.Token != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, adminError("invalid token"))
+			return
+		}
+	}
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+
+	switch {
+	case r.Method == http.MethodGet && path == "/status":
+		writeJSON(w, http.StatusOK, a.status())
+	case r.Method == http.MethodGet && path == "/config":
+		a.lock.RLock()
+		source := string(a.config)
+		a.lock.RUnlock()
+		writeJSON(w, http.StatusOK, map[string]string{"file": a.ConfigFile, "source": source})
+	case r.Method == http.MethodGet && path == "/servers":
+		writeJSON(w, http.StatusOK, a.Servers.Snapshot())
+	case r.Method == http.MethodGet && path == "/upstreams":
+		writeJSON(w, http.StatusOK, directive.Upstreams.List())
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "/upstreams/"):
+		a.changeUpstream(w, strings.TrimPrefix(path, "/upstreams/"))
+	case r.Method == http.MethodPost && path == "/reload":
+		if a.Reload == nil {
+			writeJSON(w, http.StatusNotImplemented, adminError("reload is not supported"))
+		} else if err := a.Reload(); err != nil {
+			writeJSON(w, http.StatusInternalServerError, adminError(err.Error()))
+		} else {
+			writeJSON(w, http.StatusOK, a.status())
+		}
+	default:
+		writeJSON(w, http.StatusNotFound, adminError("not found"))
+	}
+}
+
+func (a *Admin) changeUpstream(w http.ResponseWriter, p string) {
+	i := strings.LastIndex(p, "/")
+	if i < 0 || p[i+1:] != "drain" && p[i+1:] != "enable" {
+		writeJSON(w, http.StatusNotFound, adminError("expected /upstreams/{addr}/drain or /upstreams/{addr}/enable"))
+		return
+	}
+
+	if !directive.Upstreams.SetDrained(p[:i], p[i+1:] == "drain") {
+		writeJSON(w, http.StatusNotFound, adminError("unknown upstream "+p[:i]))
+		return
+	}
+
+	util.Infof("admin API %s upstream %s", p[i+1:], p[:i])
+	writeJSON(w, http.StatusOK, directive.Upstreams.List())
+}
+
+func (a *Admin) status() map[string]interface{} {
+	return map[string]interface{}{
+		"version":        a.Version,
+		"pid":            os.Getpid(),
+		"started":        a.started.Format(time.RFC3339),
+		"uptime_seconds": int64(time.Since(a.started).Seconds()),
+		"config_file":    a.ConfigFile,
+	}
+}
+
+func adminError(msg string) map[string]string { return map[string]string{"error": msg} }
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+// PortServers is the servers on the listening port.
+type PortServers struct {
+	Port    int          `json:"port"`
+	Servers []ServerInfo `json:"servers"`
+}
+
+// ServerInfo is the server and its locations in the order of matching.
+type ServerInfo struct {
+	ServerName string         `json:"server_name"`
+	Locations  []LocationInfo `json:"locations"`
+	Named      []LocationInfo `json:"named,omitempty"`
+}
+
+// LocationInfo is the location, its directives and its nested locations.
+type LocationInfo struct {
+	Location   string         `json:"location"`
+	Directives []string       `json:"directives"`
+	Locations  []LocationInfo `json:"locations,omitempty"`
+}
+
+func locationInfos(locations directive.Locations) []LocationInfo {
+	infos := make([]LocationInfo, 0, len(locations))
+	for _, l := range locations {
+		infos = append(infos, LocationInfo{
+			Location:   l.String(),
+			Directives: l.Directives(),
+			Locations:  locationInfos(l.Locations),
+		})
+	}
+
+	return infos
+}
+
+// namedInfos returns the named locations sorted by the name.
+func namedInfos(named map[string]*directive.Location) []LocationInfo {
+	locations := make(directive.Locations, 0, len(named))
+	for _, l := range named {
+		locations = append(locations, *l)
+	}
+
+	sort.Slice(locations, func(i, j int) bool { return locations[i].Path < locations[j].Path })
+
+	return locationInfos(locations)
+}
+
+// Snapshot returns the servers currently dispatched by the running servers, sorted by the port.
+func (s *RunningServers) Snapshot() []PortServers {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	ports := make([]PortServers, 0, len(s.Servers))
+
+	for port, c := range s.Servers {
+		ps := PortServers{Port: port}
+
+		for _, name := range c.serverNames {
+			server, ok := c.dispatch[name].(NginxServer)
+			if !ok {
+				continue
+			}
+
+			ps.Servers = append(ps.Servers, ServerInfo{
+				ServerName: name,
+				Locations:  locationInfos(server.Locations),
+				Named:      namedInfos(server.Named),
+			})
+		}
+
+		ports = append(ports, ps)
+	}
+
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Port < ports[j].Port })
+
+	return ports
+}
@@ -0,0 +1,115 @@
+package nginxconf_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/gonginx/directive"
+	"github.com/bingoohuang/gonginx/nginxconf"
+)
+
+func TestAdmin(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "backend")
+	}))
+	defer backend.Close()
+
+	upstream := strings.TrimPrefix(backend.URL, "http://")
+	port := freePort(t)
+	rs := startServers(t, fmt.Sprintf(`
+server {
+    listen %d;
+    server_name admin.test;
+    location /api {
+        proxy_pass %s;
+        location /api/v2 { echo v2; }
+    }
+    location @fallback { echo fallback; }
+}`, port, backend.URL))
+	defer rs.Close()
+
+	reloaded := 0
+	admin := httptest.NewServer(&nginxconf.Admin{
+		Servers: rs,
+		Token:   "secret",
+		Reload:  func() error { reloaded++; return nil },
+	})
+	defer admin.Close()
+
+	call := func(method, path, token string) (int, string) {
+		req, _ := http.NewRequest(method, admin.URL+path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rsp.Body.Close()
+
+		b, _ := io.ReadAll(rsp.Body)
+		return rsp.StatusCode, string(b)
+	}
+
+	if code, _ := call("GET", "/servers", "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for the wrong token, got %d", code)
+	}
+
+	_, body := call("GET", "/servers", "secret")
+
+	var servers []nginxconf.PortServers
+	if err := json.Unmarshal([]byte(body), &servers); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(servers) != 1 || servers[0].Port != port || servers[0].Servers[0].ServerName != "admin.test" ||
+		servers[0].Servers[0].Locations[0].Location != "/api" {
+		t.Errorf("unexpected servers %s", body)
+	}
+
+	// the nested and named locations.
+	if si := servers[0].Servers[0]; len(si.Locations[0].Locations) != 1 || len(si.Named) != 1 ||
+		si.Locations[0].Locations[0].Location != "/api/v2" || si.Named[0].Location != "@fallback" ||
+		strings.Join(si.Named[0].Directives, ",") != "echo" {
+		t.Errorf("unexpected nested and named locations %s", body)
+	}
+
+	proxy := func() int {
+		rsp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/api", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = rsp.Body.Close()
+		return rsp.StatusCode
+	}
+
+	if code, body := call("POST", "/upstreams/"+upstream+"/drain", "secret"); code != http.StatusOK {
+		t.Fatalf("drain failed %d %s", code, body)
+	}
+
+	if code := proxy(); code != http.StatusBadGateway {
+		t.Errorf("expected 502 for the drained upstream, got %d", code)
+	}
+
+	call("POST", "/upstreams/"+upstream+"/enable", "secret")
+
+	if code := proxy(); code != http.StatusOK {
+		t.Errorf("expected 200 for the enabled upstream, got %d", code)
+	}
+
+	for _, m := range directive.Upstreams.List() {
+		if m.Addr == upstream && (m.Drained || m.Requests != 1) {
+			t.Errorf("unexpected upstream state %+v", m)
+		}
+	}
+
+	if code, _ := call("POST", "/reload", "secret"); code != http.StatusOK || reloaded != 1 {
+		t.Errorf("reload failed %d, reloaded %d", code, reloaded)
+	}
+}
@@ -0,0 +1,65 @@
+package nginxconf_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuthBasic(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "htpasswd")
+	_ = os.WriteFile(file, []byte("alice:$apr1$saltsalt$LrttParrLPdxvgutaSXWJ0\n"), 0o600)
+
+	servers := parseServers(t, fmt.Sprintf(`
+server {
+    listen 15016;
+    auth_basic "Staging Area";
+    auth_basic_user_file %s;
+    location /a { echo a; }
+    location /public { auth_basic off; echo public; }
+    location /office {
+        satisfy any;
+        allow 10.0.0.0/8;
+        deny all;
+        echo office;
+    }
+}`, file))
+
+	tests := []struct {
+		uri, remote, user, password string
+		status                      int
+	}{
+		{uri: "/a", status: 401},
+		{uri: "/a", user: "alice", password: "secret", status: 200},
+		{uri: "/a", user: "alice", password: "wrong", status: 401},
+		{uri: "/a", user: "bob", password: "secret", status: 401},
+		{uri: "/public", status: 200},
+		{uri: "/office", remote: "10.1.2.3:1234", status: 200},
+		{uri: "/office", remote: "192.168.1.1:1234", status: 401},
+		{uri: "/office", remote: "192.168.1.1:1234", user: "alice", password: "secret", status: 200},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.uri, nil)
+		if tt.remote != "" {
+			r.RemoteAddr = tt.remote
+		}
+
+		if tt.user != "" {
+			r.SetBasicAuth(tt.user, tt.password)
+		}
+
+		w := httptest.NewRecorder()
+		servers[0].ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expected %d, got %d", tt.uri, tt.user, tt.status, w.Code)
+		}
+
+		if challenge := w.Header().Get("WWW-Authenticate"); (w.Code == 401) != (challenge == `Basic realm="Staging Area"`) {
+			t.Errorf("%s %s: unexpected challenge %q", tt.uri, tt.user, challenge)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package nginxconf_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func hs256(secret, payload string) string {
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString([]byte(`{"alg":"HS256","kid":"k1"}`)) + "." + enc.EncodeToString([]byte(payload))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+
+	return signed + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuthJWT(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	_ = os.WriteFile(file, []byte(`{"keys":[{"kty":"oct","kid":"k1","k":"`+
+		base64.RawURLEncoding.EncodeToString([]byte("secret"))+`"}]}`), 0o600)
+
+	servers := parseServers(t, fmt.Sprintf(`
+server {
+    listen 15018;
+    auth_jwt "api";
+    auth_jwt_key_file %s;
+    auth_jwt_issuer sso;
+    location /a {
+        add_header X-Sub $jwt_claim_sub;
+        echo a;
+    }
+    location /web { auth_jwt "web" token=$cookie_token; echo web; }
+    location /public { auth_jwt off; echo public; }
+}`, file))
+
+	exp := time.Now().Add(time.Hour).Unix()
+	valid := hs256("secret", fmt.Sprintf(`{"sub":"alice","iss":"sso","exp":%d}`, exp))
+	expired := hs256("secret", `{"sub":"alice","iss":"sso","exp":1}`)
+	forged := hs256("wrong", fmt.Sprintf(`{"sub":"alice","iss":"sso","exp":%d}`, exp))
+	otherIssuer := hs256("secret", fmt.Sprintf(`{"sub":"alice","iss":"evil","exp":%d}`, exp))
+
+	tests := []struct {
+		uri, bearer, cookie string
+		status              int
+		sub, challenge      string
+	}{
+		{uri: "/a", status: 401, challenge: `Bearer realm="api"`},
+		{uri: "/a", bearer: valid, status: 200, sub: "alice"},
+		{uri: "/a", bearer: expired, status: 401, challenge: `Bearer realm="api", error="invalid_token"`},
+		{uri: "/a", bearer: forged, status: 401, challenge: `Bearer realm="api", error="invalid_token"`},
+		{uri: "/a", bearer: otherIssuer, status: 401, challenge: `Bearer realm="api", error="invalid_token"`},
+		{uri: "/web", bearer: valid, status: 401, challenge: `Bearer realm="web"`},
+		{uri: "/web", cookie: valid, status: 200},
+		{uri: "/public", status: 200},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.uri, nil)
+		if tt.bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.bearer)
+		}
+
+		if tt.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "token", Value: tt.cookie})
+		}
+
+		w := httptest.NewRecorder()
+		servers[0].ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d", tt.uri, tt.status, w.Code)
+		}
+
+		if sub := w.Header().Get("X-Sub"); sub != tt.sub {
+			t.Errorf("%s: expected sub %q, got %q", tt.uri, tt.sub, sub)
+		}
+
+		if challenge := w.Header().Get("WWW-Authenticate"); challenge != tt.challenge {
+			t.Errorf("%s: expected challenge %q, got %q", tt.uri, tt.challenge, challenge)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package nginxconf_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthRequest(t *testing.T) {
+	sso := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/validate" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch r.Header.Get("Authorization") {
+		case "token-alice":
+			w.Header().Set("X-User", "alice")
+			w.WriteHeader(http.StatusNoContent)
+		case "token-banned":
+			w.WriteHeader(http.StatusForbidden)
+		case "token-broken":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sso"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer sso.Close()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "user=%s token=%s", r.Header.Get("X-User"), r.Header.Get("Authorization"))
+	}))
+	defer backend.Close()
+
+	servers := parseServers(t, fmt.Sprintf(`
+server {
+    listen 15017;
+    auth_request /auth;
+    auth_request_set $user $upstream_http_x_user;
+    location /auth { proxy_pass %s/validate; }
+    location /a {
+        add_header X-User $user;
+        echo a;
+    }
+    location /public { auth_request off; echo public; }
+    location /backend {
+        proxy_set_header X-User $user;
+        proxy_set_header Authorization "";
+        proxy_pass %s;
+    }
+}`, sso.URL, backend.URL))
+
+	tests := []struct {
+		uri, token, user, body string
+		status                 int
+	}{
+		{uri: "/a", status: 401},
+		{uri: "/a", token: "token-alice", user: "alice", status: 200},
+		{uri: "/a", token: "token-banned", status: 403},
+		{uri: "/a", token: "token-broken", status: 500},
+		{uri: "/public", status: 200},
+		// the backend receives the user of the auth response, but not the token.
+		{uri: "/backend", token: "token-alice", body: "user=alice token=", status: 200},
+		{uri: "/backend", token: "token-banned", status: 403},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", tt.uri, nil)
+		if tt.token != "" {
+			r.Header.Set("Authorization", tt.token)
+		}
+
+		w := httptest.NewRecorder()
+		servers[0].ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expected %d, got %d", tt.uri, tt.token, tt.status, w.Code)
+		}
+
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("%s %s: expected body %q, got %q", tt.uri, tt.token, tt.body, w.Body.String())
+		}
+
+		if user := w.Header().Get("X-User"); user != tt.user {
+			t.Errorf("%s %s: expected user %q, got %q", tt.uri, tt.token, tt.user, user)
+		}
+
+		if challenge := w.Header().Get("WWW-Authenticate"); (w.Code == 401) != (challenge == `Bearer realm="sso"`) {
+			t.Errorf("%s %s: unexpected challenge %q", tt.uri, tt.token, challenge)
+		}
+	}
+}
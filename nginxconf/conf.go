@@ -1,12 +1,12 @@
 package nginxconf
 
 import (
-	"log"
 	"reflect"
 	"sort"
 	"strings"
 
 	"github.com/bingoohuang/gonginx/directive"
+	"github.com/bingoohuang/gonginx/util"
 	"github.com/bingoohuang/gou/str"
 )
 
@@ -14,29 +14,123 @@ type NginxServer struct {
 	ListenPort int
 	Locations  directive.Locations
 	ServerName string
+	// Default holds the server level directives, for the requests matching no location.
+	Default directive.Location
+	// Named are the named locations, like @fallback, for the internal redirects.
+	Named map[string]*directive.Location
+	// Logs are the log formats and files of the configuration, shared by all its servers.
+	Logs *directive.Logs
 }
 
 func (conf NginxConfigureBlock) ParseServers() []NginxServer {
+	logs := directive.NewLogs()
+	servers := conf.parseServers(logs, nil)
+
+	for i := range servers {
+		servers[i].Logs = logs
+	}
+
+	return servers
+}
+
+// parseServers parses the servers in the block,
+// the inherited are the directives from the outer level, which apply to the inner levels unless redefined.
+func (conf NginxConfigureBlock) parseServers(logs *directive.Logs, inherited NginxConfigureBlock) []NginxServer {
 	servers := make([]NginxServer, 0)
 
 	for i := 0; i < len(conf); i++ {
 		words := conf[i].Words
 		switch {
 		case reflect.DeepEqual(words, []string{"server"}):
-			servers = append(servers, parseServer(conf[i].Block))
+			servers = append(servers, parseServer(conf[i].Block, inherited))
 		case reflect.DeepEqual(words, []string{"http"}):
-			return conf[i].Block.ParseServers()
+			return conf[i].Block.parseHTTP(logs)
+		case len(words) > 0 && mainDirectives[strings.ToLower(words[0])]:
+			continue
 		default:
-			log.Printf("W! unsupported %+v", conf[i])
+			util.Warnf("unsupported %+v", conf[i])
 		}
 	}
 
 	return servers
 }
 
-func parseServer(conf NginxConfigureBlock) (server NginxServer) {
+// parseHTTP parses the http block, with the log formats registered in logs.
+func (conf NginxConfigureBlock) parseHTTP(logs *directive.Logs) []NginxServer {
+	servers := make(NginxConfigureBlock, 0)
+	others := make(NginxConfigureBlock, 0)
+
+	for _, cmd := range conf {
+		if len(cmd.Words) == 0 {
+			continue
+		}
+
+		switch strings.ToLower(cmd.Words[0]) {
+		case "server":
+			servers = append(servers, cmd)
+		case "log_format":
+			if err := logs.RegisterLogFormat(cmd.Words[1:]); err != nil {
+				util.Warnf("invalid %v: %v", cmd.Words, err)
+			}
+		case "limit_req_zone":
+			if err := directive.RegisterLimitReqZone(cmd.Words[1:]); err != nil {
+				util.Warnf("invalid %v: %v", cmd.Words, err)
+			}
+		default:
+			others = append(others, cmd)
+		}
+	}
+
+	return servers.parseServers(logs, collectInherited(others, nil))
+}
+
+// inheritGroups are the directives sharing the same list in nginx, which are inherited all together,
+// e.g. a location with allow only does not inherit the deny of the server.
+var inheritGroups = map[string]string{"deny": "allow"}
+
+// inheritName returns the name of the directive for the inheritance.
+func inheritName(name string) string {
+	if group, ok := inheritGroups[name]; ok {
+		return group
+	}
+
+	return name
+}
+
+// collectInherited collects the directives supported by the processors in the block,
+// which replace the same ones in the outer level, and warns the unsupported.
+func collectInherited(conf NginxConfigureBlock, outer NginxConfigureBlock) NginxConfigureBlock {
+	inner := make(NginxConfigureBlock, 0)
+	names := make(map[string]bool)
+
+	for _, cmd := range conf {
+		name := strings.ToLower(cmd.Words[0])
+		if !directive.HasFactory(name) {
+			util.Warnf("unsupported %+v", cmd)
+			continue
+		}
+
+		inner = append(inner, cmd)
+		names[inheritName(name)] = true
+	}
+
+	for _, cmd := range outer {
+		if !names[inheritName(strings.ToLower(cmd.Words[0]))] {
+			inner = append(inner, cmd)
+		}
+	}
+
+	return inner
+}
+
+func parseServer(conf NginxConfigureBlock, inherited NginxConfigureBlock) (server NginxServer) {
 	server.ListenPort = 8000
 	server.Locations = make([]directive.Location, 0)
+	server.Named = make(map[string]*directive.Location)
+
+	locations := make(NginxConfigureBlock, 0)
+	rewrites := make(NginxConfigureBlock, 0)
+	others := make(NginxConfigureBlock, 0)
 
 	for _, block := range conf {
 		if len(block.Words) == 0 {
@@ -49,12 +143,32 @@ func parseServer(conf NginxConfigureBlock) (server NginxServer) {
 		case "server_name":
 			server.ServerName = block.Words[1]
 		case "location":
-			l := parseLocation(block)
-			l.Seq = len(server.Locations)
-			server.Locations = append(server.Locations, l)
+			locations = append(locations, block)
+		case "rewrite", "if", "return", "set":
+			// the server level rewrites run ahead of the location matching, not inherited by the locations.
+			rewrites = append(rewrites, block)
 		default:
-			log.Printf("W! unsupported %+v", block)
+			others = append(others, block)
+		}
+	}
+
+	inherited = collectInherited(others, inherited)
+	server.Default, _ = parseLocation(NginxConfigureCommand{Words: []string{"location", ""}, Block: rewrites}, inherited)
+
+	for _, block := range locations {
+		l, err := parseLocation(block, inherited)
+		if err != nil {
+			util.Warnf("invalid %v: %v", block.Words, err)
+			continue
 		}
+
+		if l.Priority == directive.ModifierNamed {
+			server.Named[l.Path] = &l
+			continue
+		}
+
+		l.Seq = len(server.Locations)
+		server.Locations = append(server.Locations, l)
 	}
 
 	sort.Sort(server.Locations)
@@ -0,0 +1,50 @@
+package nginxconf_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugHeaders(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer backend.Close()
+
+	servers := parseServers(t, fmt.Sprintf(`
+server {
+    listen 15005;
+    server_name debug.test;
+    debug_headers on;
+    location = /x { echo x; }
+    location ^~ /api { proxy_pass %s; }
+    location /quiet { debug_headers off; echo quiet; }
+}`, backend.URL))
+
+	tests := []struct {
+		uri, location, upstream string
+	}{
+		{uri: "/x", location: "= /x #0"},
+		{uri: "/api/a", location: "^~ /api #1", upstream: strings.TrimPrefix(backend.URL, "http://")},
+		{uri: "/quiet"},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		servers[0].ServeHTTP(w, httptest.NewRequest("GET", tt.uri, nil))
+
+		server := "debug.test"
+		if tt.location == "" {
+			server = ""
+		}
+
+		h := w.Header()
+		if h.Get("X-Gonginx-Server") != server || h.Get("X-Gonginx-Location") != tt.location ||
+			h.Get("X-Gonginx-Upstream") != tt.upstream {
+			t.Errorf("%s: unexpected debug headers %v", tt.uri, h)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package nginxconf_test
+
+import (
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestErrorLog(t *testing.T) {
+	dir := t.TempDir()
+	httpLog := filepath.Join(dir, "http.log")
+	debugLog := filepath.Join(dir, "debug.log")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := l.Addr().String()
+	_ = l.Close()
+
+	servers := parseServers(t, fmt.Sprintf(`
+http {
+    error_log %s warn;
+
+    server {
+        listen 15003;
+        server_name a.com;
+        location /warn { proxy_pass http://%s; }
+        location /debug {
+            error_log %s debug;
+            proxy_pass http://%s;
+        }
+    }
+}`, httpLog, closed, debugLog, closed))
+
+	for _, uri := range []string{"/warn", "/debug"} {
+		servers[0].ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", uri, nil))
+	}
+
+	s := readFile(t, httpLog)
+	if strings.Count(s, "\n") != 1 || !strings.Contains(s, "[error]") ||
+		!strings.Contains(s, `server: a.com, request: "GET /warn HTTP/1.1"`) {
+		t.Errorf("unexpected http level error log %q", s)
+	}
+
+	s = readFile(t, debugLog)
+	if !strings.Contains(s, `[debug]`) || !strings.Contains(s, `using configuration "/debug"`) ||
+		!strings.Contains(s, "[error]") || strings.Contains(s, "/warn") {
+		t.Errorf("unexpected location level error log %q", s)
+	}
+}
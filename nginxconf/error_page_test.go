@@ -0,0 +1,58 @@
+package nginxconf_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestErrorPage(t *testing.T) {
+	root := t.TempDir()
+	_ = os.WriteFile(filepath.Join(root, "404.html"), []byte("not found page"), 0o644)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("backend error"))
+	}))
+	defer backend.Close()
+
+	servers := parseServers(t, fmt.Sprintf(`
+server {
+    listen 15012;
+    root %s;
+    error_page 404 /404.html;
+    error_page 500 502 503 =200 @maintenance;
+    error_page 403 http://example.com/forbidden;
+    location / { }
+    location /down { proxy_pass http://127.0.0.1:1; }
+    location /backend { proxy_pass %s; }
+    location /intercepted { proxy_pass %s; proxy_intercept_errors on; }
+    location /denied { return 403; }
+    location /gone { error_page 410 = /missing.html; return 410; }
+    location @maintenance { echo maintenance; }
+}`, root, backend.URL, backend.URL))
+
+	tests := []struct {
+		uri, body, location string
+		status              int
+	}{
+		{uri: "/nothing", body: "not found page", status: 404},
+		{uri: "/down", body: "maintenance\n", status: 200},
+		{uri: "/backend", body: "backend error", status: 500},
+		{uri: "/intercepted", body: "maintenance\n", status: 200},
+		{uri: "/denied", location: "http://example.com/forbidden", status: 302},
+		{uri: "/gone", status: 404},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		servers[0].ServeHTTP(w, httptest.NewRequest("POST", tt.uri, nil))
+
+		if w.Code != tt.status || tt.body != "" && w.Body.String() != tt.body || w.Header().Get("Location") != tt.location {
+			t.Errorf("%s: unexpected %d %q %v", tt.uri, w.Code, w.Body.String(), w.Header())
+		}
+	}
+}
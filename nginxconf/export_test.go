@@ -0,0 +1,20 @@
+package nginxconf
+
+import "net"
+
+// ParseListeners and TakeInherited export the listener inheritance of the binary upgrade for the tests.
+var (
+	ParseListeners = parseListeners
+	TakeInherited  = takeInherited
+	// SystemdListeners parses the systemd sockets from the given fd, instead of 3 which the test process uses.
+	SystemdListeners = systemdListeners
+)
+
+// SetInherited replaces the inherited listeners, as if passed by the parent process.
+func SetInherited(listeners map[int]net.Listener) {
+	loadInherited()
+
+	inheritedLock.Lock()
+	inherited = listeners
+	inheritedLock.Unlock()
+}
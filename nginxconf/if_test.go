@@ -0,0 +1,103 @@
+package nginxconf_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIf(t *testing.T) {
+	root := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(root, "m"), 0o755)
+	_ = os.WriteFile(filepath.Join(root, "m", "a.txt"), []byte("a"), 0o644)
+
+	servers := parseServers(t, fmt.Sprintf(`
+server {
+    listen 15010;
+    root %s;
+    if ($http_x_legacy) { rewrite ^ /new last; }
+    location /new { echo new; }
+    location /m {
+        echo get;
+        if ($request_method = POST) { echo post; }
+        if ($http_user_agent ~* (\w+)bot) { rewrite ^ /bots/$1 last; }
+        if (!-f $request_filename) { echo missing; }
+        if ($arg_x != 1) { proxy_pass http://127.0.0.1:1; }
+    }
+    location /bots { echo bots; }
+    location /b {
+        echo b;
+        if ($arg_a) { echo a; }
+        if ($arg_s) { rewrite ^ /b break; echo s; }
+        if ($arg_c) { return 200 c; }
+    }
+}`, root))
+
+	tests := []struct {
+		method, uri, ua, legacy, body string
+		status                        int
+	}{
+		{method: "GET", uri: "/m?x=1", body: "missing\n", status: 200},
+		{method: "POST", uri: "/m?x=1", body: "missing\n", status: 200},
+		{method: "POST", uri: "/m/a.txt?x=1", body: "post\n", status: 200},
+		{method: "GET", uri: "/m/a.txt?x=1", body: "get\n", status: 200},
+		{method: "GET", uri: "/m/a.txt?x=2", status: 502},
+		{method: "GET", uri: "/m?x=1", ua: "GoogleBot", body: "bots\n", status: 200},
+		{method: "GET", uri: "/x?x=1", legacy: "1", body: "new\n", status: 200},
+		{method: "GET", uri: "/b", body: "b\n", status: 200},
+		{method: "GET", uri: "/b?a=1", body: "a\n", status: 200},
+		{method: "GET", uri: "/b?a=1&s=1", body: "s\n", status: 200},
+		{method: "GET", uri: "/b?a=1&c=1", body: "c", status: 200},
+		{method: "GET", uri: "/b?s=1&c=1", body: "s\n", status: 200},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(tt.method, tt.uri, nil)
+		r.Header.Set("User-Agent", tt.ua)
+		r.Header.Set("X-Legacy", tt.legacy)
+		servers[0].ServeHTTP(w, r)
+
+		if w.Code != tt.status || w.Body.String() != tt.body {
+			t.Errorf("%s %s: unexpected %d %q", tt.method, tt.uri, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestIfCondition(t *testing.T) {
+	servers := parseServers(t, `
+server {
+    listen 15011;
+    location /q1 { echo no; if ($http_user_agent ~* "foo bar") { echo yes; } }
+    location /q2 { echo no; if ( $http_x_a = "" ) { echo yes; } }
+    location /q3 { echo no; if ($uri ~ "^/q3/([0-9]+) ([a-z]+)$") { return 200 "yes $1 $2"; } }
+    location /q4 { echo no; if ($http_x_a) { echo yes; } }
+}`)
+
+	tests := []struct {
+		uri, ua, a, body string
+	}{
+		{uri: "/q1", ua: "a Foo Bar b", body: "yes\n"},
+		{uri: "/q1", ua: "foo", body: "no\n"},
+		{uri: "/q2", body: "yes\n"},
+		{uri: "/q2", a: "1", body: "no\n"},
+		{uri: "/q3/12%20ab", body: "yes 12 ab"},
+		{uri: "/q3/ab%20ab", body: "no\n"},
+		{uri: "/q4", a: "1", body: "yes\n"},
+		{uri: "/q4", a: "0", body: "no\n"},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", tt.uri, nil)
+		r.Header.Set("User-Agent", tt.ua)
+		r.Header.Set("X-A", tt.a)
+		servers[0].ServeHTTP(w, r)
+
+		if w.Body.String() != tt.body {
+			t.Errorf("%s ua %q a %q: expected %q, got %q", tt.uri, tt.ua, tt.a, tt.body, w.Body.String())
+		}
+	}
+}
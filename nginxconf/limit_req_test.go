@@ -0,0 +1,143 @@
+package nginxconf_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimitReq(t *testing.T) {
+	servers := parseServers(t, `
+http {
+    limit_req_zone $binary_remote_addr zone=perip:1m rate=1r/m;
+    limit_req_zone $http_api_key zone=perkey:128 rate=1r/m;
+    limit_req_zone $binary_remote_addr zone=fast:1m rate=10r/s;
+    server {
+        listen 15019;
+        limit_req zone=perip burst=1 nodelay;
+        add_header X-Limit $limit_req_status always;
+        location /a { echo a; }
+        location /api {
+            limit_req zone=perkey nodelay;
+            limit_req_status 429;
+            echo api;
+        }
+        location /dry {
+            limit_req zone=perkey;
+            limit_req_dry_run on;
+            echo dry;
+        }
+        location /slow { limit_req zone=fast burst=5; echo slow; }
+    }
+}`)
+
+	tests := []struct {
+		uri, remote, key string
+		status           int
+		limit            string
+	}{
+		{uri: "/a", remote: "10.0.0.1:1", status: 200, limit: "PASSED"},
+		{uri: "/a", remote: "10.0.0.1:2", status: 200, limit: "PASSED"},
+		{uri: "/a", remote: "10.0.0.1:3", status: 503, limit: "REJECTED"},
+		{uri: "/a", remote: "10.0.0.2:1", status: 200, limit: "PASSED"},
+		{uri: "/api", status: 200, limit: ""},
+		{uri: "/api", key: "k1", status: 200, limit: "PASSED"},
+		{uri: "/api", key: "k1", status: 429, limit: "REJECTED"},
+		{uri: "/api", key: "k2", status: 200, limit: "PASSED"},
+		// the zone of 128 bytes keeps 2 states only, k1 is evicted by k3.
+		{uri: "/api", key: "k3", status: 200, limit: "PASSED"},
+		{uri: "/api", key: "k1", status: 200, limit: "PASSED"},
+		{uri: "/dry", key: "k1", status: 200, limit: "REJECTED_DRY_RUN"},
+	}
+
+	for i, tt := range tests {
+		r := httptest.NewRequest("GET", tt.uri, nil)
+		if tt.remote != "" {
+			r.RemoteAddr = tt.remote
+		}
+
+		if tt.key != "" {
+			r.Header.Set("Api-Key", tt.key)
+		}
+
+		w := httptest.NewRecorder()
+		servers[0].ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("#%d %s %s: expected %d, got %d", i, tt.uri, tt.key, tt.status, w.Code)
+		}
+
+		if limit := w.Header().Get("X-Limit"); limit != tt.limit {
+			t.Errorf("#%d %s %s: expected %q, got %q", i, tt.uri, tt.key, tt.limit, limit)
+		}
+	}
+
+	for i, expected := range []string{"PASSED", "DELAYED"} {
+		r := httptest.NewRequest("GET", "/slow", nil)
+		w := httptest.NewRecorder()
+		start := time.Now()
+		servers[0].ServeHTTP(w, r)
+
+		if limit := w.Header().Get("X-Limit"); w.Code != 200 || limit != expected {
+			t.Errorf("#%d /slow: expected 200 %s, got %d %s", i, expected, w.Code, limit)
+		}
+
+		if elapsed := time.Since(start); expected == "DELAYED" && elapsed < 50*time.Millisecond {
+			t.Errorf("#%d /slow: expected delayed, got %s", i, elapsed)
+		}
+	}
+}
+
+func TestLimitReqMultipleAndReload(t *testing.T) {
+	conf := func(rate string) string {
+		return fmt.Sprintf(`
+http {
+    limit_req_zone $binary_remote_addr zone=multiip:1m rate=1r/m;
+    limit_req_zone $http_api_key zone=multikey:1m rate=%s;
+    server {
+        listen 15020;
+        location / {
+            limit_req zone=multiip burst=1 nodelay;
+            limit_req zone=multikey nodelay;
+            echo ok;
+        }
+    }
+}`, rate)
+	}
+
+	servers := parseServers(t, conf("1r/m"))
+
+	tests := []struct {
+		reload, remote, key string
+		status              int
+	}{
+		{remote: "10.0.0.1:1", key: "k1", status: 200},
+		// rejected by multikey, the request is not accounted in multiip.
+		{remote: "10.0.0.1:1", key: "k1", status: 503},
+		{remote: "10.0.0.1:1", key: "k2", status: 200},
+		{remote: "10.0.0.1:1", key: "k3", status: 503},
+		// the states are kept by the reload of the same zones.
+		{reload: "1r/m", remote: "10.0.0.2:1", key: "k1", status: 503},
+		{reload: "1r/m", remote: "10.0.0.1:1", key: "k4", status: 503},
+		// and reset when the rate changes.
+		{reload: "2r/m", remote: "10.0.0.2:1", key: "k1", status: 200},
+	}
+
+	for i, tt := range tests {
+		if tt.reload != "" {
+			servers = parseServers(t, conf(tt.reload))
+		}
+
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		r.Header.Set("Api-Key", tt.key)
+
+		w := httptest.NewRecorder()
+		servers[0].ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("#%d %s %s: expected %d, got %d", i, tt.remote, tt.key, tt.status, w.Code)
+		}
+	}
+}
@@ -1,42 +1,237 @@
 package nginxconf
 
 import (
-	"log"
+	"fmt"
 	"regexp"
 	"sort"
 	"strings"
 
 	"github.com/bingoohuang/gonginx/directive"
+	"github.com/bingoohuang/gonginx/util"
 )
 
-func parseLocation(conf NginxConfigureCommand) (l directive.Location) {
-	if len(conf.Words) == 2 {
+// locationOnly are the directives not inherited by the nested locations, like the nginx content handlers.
+var locationOnly = map[string]bool{
+	"proxy_pass":  true,
+	"echo":        true,
+	"return":      true,
+	"stub_status": true,
+	"metrics":     true,
+	"try_files":   true,
+	"rewrite":     true,
+	"set":         true,
+}
+
+// contentHandlers are the directives generating the response, only one of them serves a location.
+var contentHandlers = map[string]bool{"proxy_pass": true, "echo": true, "stub_status": true, "metrics": true}
+
+// parseLocation parses the location block with its nested locations,
+// the inherited directives apply when the same directives are not defined in the location.
+func parseLocation(conf NginxConfigureCommand, inherited NginxConfigureBlock) (l directive.Location, err error) {
+	switch len(conf.Words) {
+	case 2:
 		l.Path = conf.Words[1]
-	} else {
+	case 3:
 		l.Modifier = directive.Modifier(conf.Words[1])
 		l.Path = conf.Words[2]
+	default:
+		return l, fmt.Errorf("invalid location %v", conf.Words[1:])
+	}
+
+	if l.Priority, err = l.Modifier.Priority(l.Path); err != nil {
+		return l, err
 	}
 
-	if l.Priority = l.Modifier.Priority(); l.Priority == directive.ModifierRegular {
+	if l.Priority == directive.ModifierRegular {
 		reg := l.Path
 		if l.Modifier == "~*" {
 			reg = "(?i)" + reg
 		}
 
-		l.Pattern = regexp.MustCompile(reg)
+		if l.Pattern, err = regexp.Compile(reg); err != nil {
+			return l, err
+		}
 	}
 
 	l.Processors = make(directive.Processors, 0)
+	defined := make(map[string]bool)
+	own := make(NginxConfigureBlock, 0)
+	nested := make(NginxConfigureBlock, 0)
+	bodyInherited := ifInherited(conf.Block, inherited)
 
 	for _, block := range conf.Block {
 		directiveName := strings.ToLower(block.Words[0])
+		if directiveName == "location" {
+			nested = append(nested, block)
+			continue
+		}
+
+		if directiveName == "if" {
+			if p, err := parseIf(block, l, bodyInherited); err != nil {
+				util.Warnf("invalid %v: %v", block.Words, err)
+			} else {
+				l.Processors = append(l.Processors, p)
+			}
+
+			continue
+		}
+
+		defined[inheritName(directiveName)] = true
+		own = append(own, block)
 
 		if !l.Parse(directiveName, block.Words[1:]) {
-			log.Printf("W! unsupported %+v", block.Words)
+			util.Warnf("unsupported %+v", block.Words)
+		}
+	}
+
+	for _, block := range inherited {
+		if directiveName := strings.ToLower(block.Words[0]); !defined[inheritName(directiveName)] {
+			l.Parse(directiveName, block.Words[1:])
+		}
+	}
+
+	// stable to keep the processors defined in the location ahead of the inherited ones.
+	sort.Stable(l.Processors)
+
+	l.Locations = parseNestedLocations(nested, nestedInherited(own, inherited))
+
+	return l, nil
+}
+
+// parseNestedLocations parses the locations nested in a location.
+func parseNestedLocations(blocks NginxConfigureBlock, inherited NginxConfigureBlock) directive.Locations {
+	locations := make(directive.Locations, 0, len(blocks))
+
+	for _, block := range blocks {
+		l, err := parseLocation(block, inherited)
+		if err != nil {
+			util.Warnf("invalid %v: %v", block.Words, err)
+			continue
+		}
+
+		if l.Priority == directive.ModifierNamed {
+			util.Warnf("named location %s can be on the server level only", l.Path)
+			continue
+		}
+
+		l.Seq = len(locations)
+		locations = append(locations, l)
+	}
+
+	sort.Sort(locations)
+
+	return locations
+}
+
+// nestedInherited returns the directives inherited by the nested locations,
+// the ones of the location replace the same ones inherited from the outer levels.
+func nestedInherited(own, inherited NginxConfigureBlock) NginxConfigureBlock {
+	result := make(NginxConfigureBlock, 0, len(own)+len(inherited))
+	names := make(map[string]bool)
+
+	for _, cmd := range own {
+		if name := strings.ToLower(cmd.Words[0]); !locationOnly[name] && directive.HasFactory(name) {
+			result = append(result, cmd)
+			names[inheritName(name)] = true
+		}
+	}
+
+	for _, cmd := range inherited {
+		if !names[inheritName(strings.ToLower(cmd.Words[0]))] {
+			result = append(result, cmd)
 		}
 	}
 
-	sort.Sort(l.Processors)
+	return result
+}
+
+// rewriteModule are the directives of the rewrite module, run in the if blocks by their own, never inherited into them.
+var rewriteModule = map[string]bool{"rewrite": true, "return": true, "if": true, "set": true}
+
+// serverIfAllowed and locationIfAllowed are the directives allowed in the if blocks of the server and location levels.
+var (
+	serverIfAllowed   = map[string]bool{"rewrite": true, "return": true, "set": true, "rewrite_log": true}
+	locationIfAllowed = map[string]bool{
+		"rewrite": true, "return": true, "set": true, "rewrite_log": true,
+		"proxy_pass": true, "echo": true, "root": true, "access_log": true, "debug_headers": true, "error_page": true,
+		"add_header": true, "add_trailer": true, "proxy_set_header": true,
+	}
+)
+
+// parseIf parses the if block in the location l, the server level if the path of l is empty.
+// The body of the location level inherits the directives of the location except the rewrite module ones.
+func parseIf(conf NginxConfigureCommand, l directive.Location, inherited NginxConfigureBlock) (*directive.If, error) {
+	cond, err := directive.ParseCondition(conf.Words[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	server := l.Path == ""
+	allowed := locationIfAllowed
+
+	if server {
+		allowed, inherited = serverIfAllowed, nil
+	}
+
+	block := make(NginxConfigureBlock, 0, len(conf.Block))
+	content := false
+
+	for _, cmd := range conf.Block {
+		name := strings.ToLower(cmd.Words[0])
+		if !allowed[name] {
+			util.Warnf("\"%s\" directive is not allowed in if", name)
+			continue
+		}
+
+		block = append(block, cmd)
+		content = content || contentHandlers[name]
+	}
+
+	if content {
+		// the content handler of the body, like proxy_pass, replaces the ones of the location, like echo.
+		inherited = filterBlock(inherited, func(name string) bool { return !contentHandlers[name] })
+	}
+
+	body, err := parseLocation(NginxConfigureCommand{Words: []string{"location", l.Path}, Block: block}, inherited)
+	if err != nil {
+		return nil, err
+	}
+
+	body.Modifier, body.Priority, body.Pattern = l.Modifier, l.Priority, l.Pattern
+
+	return &directive.If{Condition: cond, Body: body, Server: server}, nil
+}
+
+// ifInherited returns the directives inherited by the if blocks in the location, the block is of the location.
+func ifInherited(block, inherited NginxConfigureBlock) NginxConfigureBlock {
+	result := make(NginxConfigureBlock, 0, len(block)+len(inherited))
+	names := make(map[string]bool)
+
+	for _, cmd := range block {
+		if name := strings.ToLower(cmd.Words[0]); !rewriteModule[name] && directive.HasFactory(name) {
+			result = append(result, cmd)
+			names[inheritName(name)] = true
+		}
+	}
+
+	for _, cmd := range inherited {
+		if name := strings.ToLower(cmd.Words[0]); !names[inheritName(name)] && !rewriteModule[name] {
+			result = append(result, cmd)
+		}
+	}
+
+	return result
+}
+
+// filterBlock returns the directives of the block whose names are accepted by the keep.
+func filterBlock(block NginxConfigureBlock, keep func(name string) bool) NginxConfigureBlock {
+	result := make(NginxConfigureBlock, 0, len(block))
+
+	for _, cmd := range block {
+		if keep(strings.ToLower(cmd.Words[0])) {
+			result = append(result, cmd)
+		}
+	}
 
-	return l
+	return result
 }
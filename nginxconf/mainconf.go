@@ -0,0 +1,101 @@
+package nginxconf
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bingoohuang/gonginx/util"
+)
+
+// NginxMain holds the directives in the main context, outside of the http block.
+type NginxMain struct {
+	// ShutdownTimeout limits the graceful shutdown, zero means waiting until all requests finished.
+	// http://nginx.org/en/docs/ngx_core_module.html#worker_shutdown_timeout
+	ShutdownTimeout time.Duration
+	// Pid is the file storing the process ID of the running gonginx.
+	// http://nginx.org/en/docs/ngx_core_module.html#pid
+	Pid string
+	// ErrorLog is the target of the error log, a file, stderr or syslog:..., empty for the default one of golog.
+	// http://nginx.org/en/docs/ngx_core_module.html#error_log
+	ErrorLog      string
+	ErrorLogLevel util.Level
+	// ErrorLogRotate is the built-in rotation of the error log, not in nginx.
+	ErrorLogRotate util.RotateOption
+
+	// AdminListen is the address of the admin API, host:port or unix:/path, not in nginx.
+	// Syntax: admin_listen address [token=token] [mode=0600];.
+	AdminListen string
+	// AdminToken is required in the Authorization: Bearer header of the admin API, if not empty.
+	AdminToken string
+	// AdminSocketMode is the permissions of the admin unix socket file.
+	AdminSocketMode os.FileMode
+}
+
+// DefaultPid is the default pid file when the pid directive is absent.
+const DefaultPid = "gonginx.pid"
+
+// mainDirectives are the directives handled by ParseMain.
+var mainDirectives = map[string]bool{
+	"worker_shutdown_timeout": true,
+	"pid":                     true,
+	"error_log":               true,
+	"admin_listen":            true,
+}
+
+// ParseMain parses the directives in the main context.
+func (conf NginxConfigureBlock) ParseMain() (m NginxMain) {
+	m.Pid = DefaultPid
+	m.AdminSocketMode = 0o600
+
+	for _, cmd := range conf {
+		if len(cmd.Words) < 2 {
+			continue
+		}
+
+		switch strings.ToLower(cmd.Words[0]) {
+		case "worker_shutdown_timeout":
+			d, err := util.ParseDuration(cmd.Words[1])
+			if err != nil {
+				util.Warnf("invalid worker_shutdown_timeout %v: %v", cmd.Words[1], err)
+				continue
+			}
+			m.ShutdownTimeout = d
+		case "pid":
+			m.Pid = cmd.Words[1]
+		case "error_log":
+			m.ErrorLog = cmd.Words[1]
+			m.ErrorLogLevel = util.LevelError
+			m.ErrorLogRotate = util.RotateOption{}
+
+			for _, p := range cmd.Words[2:] {
+				if level, ok := util.ParseLevel(p); ok {
+					m.ErrorLogLevel = level
+				} else if ok, err := m.ErrorLogRotate.ParseRotateParam(p); !ok || err != nil {
+					util.Warnf("invalid error_log parameter %s: %v", p, err)
+				}
+			}
+		case "admin_listen":
+			m.AdminListen = cmd.Words[1]
+
+			for _, p := range cmd.Words[2:] {
+				switch {
+				case strings.HasPrefix(p, "token="):
+					m.AdminToken = strings.TrimPrefix(p, "token=")
+				case strings.HasPrefix(p, "mode="):
+					mode, err := strconv.ParseUint(strings.TrimPrefix(p, "mode="), 8, 32)
+					if err != nil {
+						util.Warnf("invalid admin_listen parameter %s: %v", p, err)
+						continue
+					}
+					m.AdminSocketMode = os.FileMode(mode)
+				default:
+					util.Warnf("unsupported admin_listen parameter %s", p)
+				}
+			}
+		}
+	}
+
+	return m
+}
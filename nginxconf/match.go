@@ -0,0 +1,117 @@
+package nginxconf
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ExplainMatch writes which listener, server, location and processors serve the URL, and why,
+// as the running servers do, for the gonginx match command.
+func ExplainMatch(w io.Writer, servers []NginxServer, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid URL %q, expected like http://host:port/path", rawURL)
+	}
+
+	port := 80
+	if u.Scheme == "https" {
+		port = 443
+	}
+
+	if p := u.Port(); p != "" {
+		if port, err = strconv.Atoi(p); err != nil {
+			return fmt.Errorf("invalid port in URL %q", rawURL)
+		}
+	}
+
+	containers := make(map[int]*container)
+	for _, server := range servers {
+		register(containers, server)
+	}
+
+	c, ok := containers[port]
+	if !ok {
+		return fmt.Errorf("no server listens on port %d", port)
+	}
+
+	c.prepare()
+	defer c.close()
+
+	host := u.Hostname()
+	name, rule := c.find(host)
+	server := c.dispatch[name].(NginxServer)
+
+	fmt.Fprintf(w, "listener: :%d (%d servers)\n", port, len(c.serverNames))
+	fmt.Fprintf(w, "server: %s (%s)\n", name, rule)
+
+	for _, other := range c.serverNames {
+		if other != name {
+			fmt.Fprintf(w, "  rejected server %s: %s\n", other, c.rejectServer(other, host, rule))
+		}
+	}
+
+	r, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	chosen, candidates := server.Locations.ExplainLocation(r)
+	reason := ""
+
+	for _, candidate := range candidates {
+		switch {
+		case chosen != nil && candidate.Location.String() == chosen.String():
+			reason = candidate.Reason
+		case candidate.Matched:
+			fmt.Fprintf(w, "  rejected location %s: %s, but %s takes precedence\n",
+				candidate.Location, candidate.Reason, chosen)
+		default:
+			fmt.Fprintf(w, "  rejected location %s: %s\n", candidate.Location, candidate.Reason)
+		}
+	}
+
+	if chosen != nil {
+		fmt.Fprintf(w, "location: %s (%s)\n", chosen, reason)
+		fmt.Fprintf(w, "processors: %s\n", strings.Join(chosen.Directives(), ", "))
+
+		return nil
+	}
+
+	fmt.Fprintf(w, "location: none matched")
+	if r.URL.Path == "/" {
+		fmt.Fprintf(w, ", the welcome page is served")
+	}
+
+	fmt.Fprintf(w, "\nprocessors: %s (server level, log phase only)\n", strings.Join(server.Default.Directives(), ", "))
+
+	return nil
+}
+
+// rejectServer tells why the server name is not chosen for the host, when the chosen one is matched by the rule.
+func (c *container) rejectServer(name, host, chosenRule string) string {
+	rules := []string{ruleExact, ruleStarStarting, ruleStarEnding, ruleRegex}
+	matches := []bool{
+		name == host,
+		strings.HasPrefix(name, "*") && strings.HasSuffix(host, name[1:]),
+		strings.HasSuffix(name, "*") && strings.HasPrefix(host, name[:len(name)-1]),
+		c.regexMatch(name, host),
+	}
+
+	for i, matched := range matches {
+		if !matched {
+			continue
+		}
+
+		if rules[i] == chosenRule {
+			return fmt.Sprintf("also matches by the %s, but the chosen one takes precedence", rules[i])
+		}
+
+		return fmt.Sprintf("matches by the %s, which has a lower precedence than the %s", rules[i], chosenRule)
+	}
+
+	return "does not match the host " + host
+}
@@ -0,0 +1,81 @@
+package nginxconf_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/gonginx/nginxconf"
+)
+
+func TestExplainMatch(t *testing.T) {
+	servers := parseServers(t, `
+server { listen 15004; server_name a.com; location / { echo a; } }
+server {
+    listen 15004;
+    server_name *.b.com;
+    location = /x { echo x; }
+    location ~ \.png$ { echo png; }
+    location /api { echo api; }
+}`)
+
+	var b strings.Builder
+	if err := nginxconf.ExplainMatch(&b, servers, "http://www.b.com:15004/api/a.png"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"listener: :15004 (2 servers)\n",
+		"server: *.b.com (wildcard name starting with an asterisk)\n",
+		"  rejected server a.com: does not match the host www.b.com\n",
+		"  rejected location = /x: the path is not exactly /x\n",
+		"location: ~ \\.png$ (the path matches the regular expression \\.png$)\n",
+		"processors: echo\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("missing %q in\n%s", want, b.String())
+		}
+	}
+
+	if err := nginxconf.ExplainMatch(&b, servers, "http://a.com:1/"); err == nil {
+		t.Error("expected error for the port not listened")
+	}
+}
+
+func TestServerNameRegex(t *testing.T) {
+	servers := parseServers(t, `
+server { listen 15005; server_name ~^www\d+\.(?!admin)\w+\.net$; location / { echo www; } }
+server { listen 15005; server_name a.b.com; location / { echo a; } }
+server { listen 15005; server_name ~(; location / { echo invalid; } }`)
+
+	tests := []struct {
+		host, server string
+		rejected     []string
+	}{
+		{
+			host:     "www1.x.net",
+			server:   `~^www\d+\.(?!admin)\w+\.net$ (regular expression)`,
+			rejected: []string{"a.b.com: does not match the host www1.x.net", "~(: does not match the host www1.x.net"},
+		},
+		// the names without ~ are not regular expressions.
+		{
+			host:     "aXbXcom",
+			server:   `~^www\d+\.(?!admin)\w+\.net$ (the first server on the port)`,
+			rejected: []string{"a.b.com: does not match the host aXbXcom"},
+		},
+		{host: "www1.admin.net", server: `~^www\d+\.(?!admin)\w+\.net$ (the first server on the port)`},
+		{host: "a.b.com", server: "a.b.com (exact name)"},
+	}
+
+	for _, tt := range tests {
+		var b strings.Builder
+		if err := nginxconf.ExplainMatch(&b, servers, "http://"+tt.host+":15005/"); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, want := range append([]string{"server: " + tt.server + "\n"}, tt.rejected...) {
+			if !strings.Contains(b.String(), want) {
+				t.Errorf("%s: missing %q in\n%s", tt.host, want, b.String())
+			}
+		}
+	}
+}
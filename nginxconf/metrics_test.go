@@ -0,0 +1,66 @@
+package nginxconf_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestStubStatusAndMetrics(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer backend.Close()
+
+	port := freePort(t)
+	rs := startServers(t, fmt.Sprintf(`
+server {
+    listen %d;
+    server_name metrics.test;
+    location = /status { stub_status; }
+    location = /metrics { metrics; }
+    location /api { proxy_pass %s; }
+}`, port, backend.URL))
+	defer rs.Close()
+
+	get := func(uri string) string {
+		rsp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d%s", port, uri))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rsp.Body.Close()
+
+		b, _ := io.ReadAll(rsp.Body)
+		return string(b)
+	}
+
+	get("/api/a")
+	get("/api/b")
+
+	status := get("/status")
+	if !regexp.MustCompile(`^Active connections: \d+ \nserver accepts handled requests\n \d+ \d+ \d+ \n` +
+		`Reading: \d+ Writing: [1-9]\d* Waiting: \d+ \n$`).MatchString(status) {
+		t.Errorf("unexpected stub_status %q", status)
+	}
+
+	metrics := get("/metrics")
+	upstream := strings.TrimPrefix(backend.URL, "http://")
+
+	for _, want := range []string{
+		`gonginx_http_location_requests_total{server="metrics.test",location="/api",code="4xx"} 2`,
+		`gonginx_http_location_requests_total{server="metrics.test",location="= /status",code="2xx"} 1`,
+		`gonginx_http_location_request_duration_seconds_count{server="metrics.test",location="/api"} 2`,
+		`gonginx_upstream_up{upstream="` + upstream + `"} 1`,
+		`gonginx_upstream_responses_total{upstream="` + upstream + `",code="4xx"} 2`,
+		`gonginx_upstream_response_duration_seconds_bucket{upstream="` + upstream + `",le="+Inf"} 2`,
+		"# TYPE gonginx_connections_accepted_total counter",
+	} {
+		if !strings.Contains(metrics, want+"\n") {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
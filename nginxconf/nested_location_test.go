@@ -0,0 +1,81 @@
+package nginxconf_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bingoohuang/gonginx/directive"
+)
+
+func TestNestedLocations(t *testing.T) {
+	servers := parseServers(t, `
+server {
+    listen 15006;
+    location /a {
+        echo a;
+        location /a/b { echo ab; }
+        location ~ \.png$ { echo a-png; }
+    }
+    location ^~ /a/b/c { echo abc; }
+    location ~ \.png$ { echo png; }
+    location @fallback { echo fallback; }
+    location bad /x { echo bad; }
+}`)
+
+	tests := []struct {
+		uri, body string
+	}{
+		{uri: "/a", body: "a\n"},
+		{uri: "/a/b", body: "ab\n"},
+		{uri: "/a/x.png", body: "a-png\n"},
+		{uri: "/a/b/c/x.png", body: "abc\n"},
+		{uri: "/z.png", body: "png\n"},
+		{uri: "/@fallback", body: ""},
+		{uri: "/x", body: ""},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		servers[0].ServeHTTP(w, httptest.NewRequest("GET", tt.uri, nil))
+
+		if body := w.Body.String(); body != tt.body {
+			t.Errorf("%s: expected %q, got %q", tt.uri, tt.body, body)
+		}
+	}
+}
+
+func TestInternalRedirect(t *testing.T) {
+	servers := parseServers(t, `
+server {
+    listen 15007;
+    location /a { echo a; }
+    location @fallback { echo fallback; }
+}`)
+
+	tests := []struct {
+		uri, body, path string
+		status          int
+	}{
+		{uri: "@fallback", body: "fallback\n", status: 200},
+		{uri: "/a/b?x=1", body: "a\n", path: "/a/b?x=1", status: 200},
+		{uri: "@missing", status: 500},
+		{uri: "/z", status: 404},
+	}
+
+	for _, tt := range tests {
+		w, r := directive.StartRequest(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), "")
+		rc := directive.GetRequestContext(r)
+		rc.Locations, rc.Named = servers[0].Locations, servers[0].Named
+
+		directive.InternalRedirect(w, r, tt.uri)
+
+		recorder := w.ResponseWriter.(*httptest.ResponseRecorder)
+		if recorder.Code != tt.status || recorder.Body.String() != tt.body {
+			t.Errorf("%s: unexpected %d %q", tt.uri, recorder.Code, recorder.Body.String())
+		}
+
+		if tt.path != "" && r.URL.RequestURI() != tt.path {
+			t.Errorf("%s: expected the request URI changed to %s, got %s", tt.uri, tt.path, r.URL.RequestURI())
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package nginxconf_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReturn(t *testing.T) {
+	servers := parseServers(t, `
+server {
+    listen 15011;
+    if ($http_x_blocked) { return 403 blocked; }
+    location /json1 {
+        default_type application/json;
+        return 200 '"result":"hello world!"}';
+        echo '{"status":"success",';
+    }
+    location /https { return 301 https://$host$request_uri; }
+    location /url { return https://example.com/$arg_to; }
+    location /text { return 200 "uri=$uri"; }
+    location /close { return 444; }
+    location /twice { return 301 /one; return 302 /two; }
+}`)
+
+	tests := []struct {
+		uri, blocked, body, location, contentType string
+		status                                    int
+	}{
+		{uri: "/json1", body: `"result":"hello world!"}`, contentType: "application/json", status: 200},
+		{uri: "/https?a=1", location: "https://example.com/https?a=1", status: 301},
+		{uri: "/url?to=x", location: "https://example.com/x", status: 302},
+		{uri: "/text", body: "uri=/text", status: 200},
+		{uri: "/json1", blocked: "1", body: "blocked", status: 403},
+		// the first return stops the location.
+		{uri: "/twice", location: "/one", status: 301},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", tt.uri, nil)
+		r.Host = "example.com"
+		r.Header.Set("X-Blocked", tt.blocked)
+		servers[0].ServeHTTP(w, r)
+
+		if w.Code != tt.status || w.Body.String() != tt.body || w.Header().Get("Location") != tt.location ||
+			tt.contentType != "" && w.Header().Get("Content-Type") != tt.contentType {
+			t.Errorf("%s: unexpected %d %q %v", tt.uri, w.Code, w.Body.String(), w.Header())
+		}
+	}
+
+	ts := httptest.NewServer(servers[0])
+	defer ts.Close()
+
+	if rsp, err := http.Get(ts.URL + "/close"); err == nil {
+		rsp.Body.Close()
+		t.Errorf("expected the connection closed for 444, got %d", rsp.StatusCode)
+	}
+}
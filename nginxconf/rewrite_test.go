@@ -0,0 +1,109 @@
+package nginxconf_test
+
+import (
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/bingoohuang/gonginx/directive"
+)
+
+func TestRewrite(t *testing.T) {
+	servers := parseServers(t, `
+server {
+    listen 15009;
+    rewrite ^/old/(.*)$ /new/$1 permanent;
+    rewrite ^/legacy/(?<id>\d+)$ /items/$id last;
+    location /new { echo new; }
+    location /items { echo items; }
+    location /a {
+        rewrite ^/a/(\w+)/(\w+)$ /b/$2/$1?x=1 last;
+        rewrite ^/a/stay$ /a/stayed break;
+        rewrite ^/a/go$ https://example.com/go;
+        rewrite ^/a/plain$ /b/plain;
+        echo a;
+    }
+    location /b { echo b; }
+    location /loop { rewrite ^ /loop last; }
+    location /c {
+        rewrite ^/c$ /b;
+        if ($uri = /b) { return 418 x; }
+        return 200 after;
+    }
+    location /d { rewrite ^/d$ /b; return 200 after; }
+    location /e { rewrite ^/e$ /b last; return 200 after; }
+    location /f { rewrite ^/f$ /b; rewrite ^/b$ /new; }
+    location /s {
+        set $who "$arg_n!";
+        if ($who = "x!") { return 200 yes; }
+        return 200 $who;
+    }
+}`)
+
+	tests := []struct {
+		uri, body, location string
+		status              int
+	}{
+		{uri: "/old/x?y=2", location: "/new/x?y=2", status: 301},
+		{uri: "/legacy/12", body: "items\n", status: 200},
+		{uri: "/a/p/q?y=2", body: "b\n", status: 200},
+		{uri: "/a/stay", body: "a\n", status: 200},
+		{uri: "/a/go", location: "https://example.com/go", status: 302},
+		{uri: "/a/plain", body: "b\n", status: 200},
+		{uri: "/loop", status: 500},
+		// the rewrite module directives run in order, the location is searched again after all of them.
+		{uri: "/c", body: "x", status: 418},
+		{uri: "/d", body: "after", status: 200},
+		{uri: "/e", body: "b\n", status: 200},
+		{uri: "/f", body: "new\n", status: 200},
+		{uri: "/s?n=x", body: "yes", status: 200},
+		{uri: "/s?n=y", body: "y!", status: 200},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		servers[0].ServeHTTP(w, httptest.NewRequest("GET", tt.uri, nil))
+
+		if w.Code != tt.status || tt.body != "" && w.Body.String() != tt.body ||
+			w.Header().Get("Location") != tt.location {
+			t.Errorf("%s: unexpected %d %q %v", tt.uri, w.Code, w.Body.String(), w.Header())
+		}
+	}
+}
+
+func TestCompileRegex(t *testing.T) {
+	tests := []struct {
+		expr, subject string
+		matches       []string
+		names         []string
+		invalid       bool
+	}{
+		{expr: `^/legacy/(?<id>\d+)$`, subject: "/legacy/12", matches: []string{"/legacy/12", "12"}, names: []string{"", "id"}},
+		{expr: `^/legacy/(?'id'\d+)$`, subject: "/legacy/12", matches: []string{"/legacy/12", "12"}, names: []string{"", "id"}},
+		// the backreferences and lookarounds of PCRE.
+		{expr: `^/(\w+)/\1$`, subject: "/a/a", matches: []string{"/a/a", "a"}, names: []string{"", ""}},
+		{expr: `^/(\w+)/\1$`, subject: "/a/b", names: []string{"", ""}},
+		{expr: `^/(?!admin)`, subject: "/admin", names: []string{""}},
+		{expr: `^/(?!admin)`, subject: "/user", matches: []string{"/"}, names: []string{""}},
+		{expr: `^/(`, invalid: true},
+	}
+
+	for _, tt := range tests {
+		re, err := directive.CompileRegex(tt.expr)
+		if (err != nil) != tt.invalid {
+			t.Errorf("%s: expected invalid %v, got %v", tt.expr, tt.invalid, err)
+		}
+
+		if err != nil {
+			continue
+		}
+
+		if got := re.FindStringSubmatch(tt.subject); !slices.Equal(got, tt.matches) {
+			t.Errorf("%s: expected matches %q of %s, got %q", tt.expr, tt.matches, tt.subject, got)
+		}
+
+		if !slices.Equal(re.Names, tt.names) {
+			t.Errorf("%s: expected names %q, got %q", tt.expr, tt.names, re.Names)
+		}
+	}
+}
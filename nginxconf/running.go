@@ -0,0 +1,308 @@
+package nginxconf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/gonginx/directive"
+	"github.com/bingoohuang/gonginx/util"
+)
+
+// RunningServers holds the servers grouped by the listening port.
+type RunningServers struct {
+	lock    sync.RWMutex
+	Servers map[int]*container
+
+	httpServers map[int]*http.Server
+	listeners   map[int]net.Listener
+	// logs are the log files of the configurations served, closed when replaced by the reload.
+	logs map[*directive.Logs]struct{}
+
+	hijackedLock sync.Mutex
+	// hijacked keeps the connections taken over from the http.Server, like WebSocket ones,
+	// which are invisible to http.Server.Shutdown.
+	hijacked map[net.Conn]struct{}
+}
+
+func NewRunningServers() *RunningServers {
+	return &RunningServers{
+		Servers:     make(map[int]*container),
+		httpServers: make(map[int]*http.Server),
+		listeners:   make(map[int]net.Listener),
+		logs:        make(map[*directive.Logs]struct{}),
+		hijacked:    make(map[net.Conn]struct{}),
+	}
+}
+
+func (s *RunningServers) Register(server NginxServer) {
+	register(s.Servers, server)
+
+	if server.Logs != nil {
+		s.logs[server.Logs] = struct{}{}
+	}
+}
+
+func register(containers map[int]*container, server NginxServer) {
+	c, ok := containers[server.ListenPort]
+	if !ok {
+		c = &container{dispatch: make(map[string]http.Handler)}
+		containers[server.ListenPort] = c
+	}
+
+	c.Register(server)
+}
+
+type connContextKey struct{}
+
+// Start listens on the ports of the servers and serves them,
+// the error tells the ports failed to listen, while the others are served still.
+func (s *RunningServers) Start() error {
+	s.lock.Lock()
+	for _, c := range s.Servers {
+		c.prepare()
+	}
+	s.lock.Unlock()
+
+	err := s.serve()
+	closeInheritedListeners()
+
+	return err
+}
+
+// Reload replaces the running servers with the new ones.
+// The ports already listened keep their listeners, the new ports are listened,
+// and the ports no longer configured are shut down gracefully.
+func (s *RunningServers) Reload(servers []NginxServer) {
+	containers := make(map[int]*container)
+	logs := make(map[*directive.Logs]struct{})
+
+	for _, server := range servers {
+		register(containers, server)
+
+		if server.Logs != nil {
+			logs[server.Logs] = struct{}{}
+		}
+	}
+
+	for _, c := range containers {
+		c.prepare()
+	}
+
+	s.lock.Lock()
+	obsoleteContainers := s.Servers
+	s.Servers = containers
+	obsoleteLogs := s.logs
+	s.logs = logs
+
+	var obsoletes []*http.Server
+
+	for port, server := range s.httpServers {
+		if _, ok := containers[port]; !ok {
+			obsoletes = append(obsoletes, server)
+			delete(s.httpServers, port)
+			delete(s.listeners, port)
+		}
+	}
+	s.lock.Unlock()
+
+	// the ports failed to listen are logged, the others take effect still.
+	_ = s.serve()
+
+	for _, c := range obsoleteContainers {
+		c.close()
+	}
+
+	// the log files removed or changed are closed, the ones unchanged are kept open by the new configuration.
+	for l := range obsoleteLogs {
+		if _, ok := logs[l]; !ok {
+			l.Close()
+		}
+	}
+
+	for _, server := range obsoletes {
+		go func(server *http.Server) {
+			util.Infof("stop listening on %v", server.Addr)
+
+			if err := server.Shutdown(context.Background()); err != nil {
+				util.Warnf("shutdown %v error: %v", server.Addr, err)
+			}
+		}(server)
+	}
+}
+
+// serve starts the http servers for the ports which are not served yet, and returns the errors to listen.
+func (s *RunningServers) serve() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var errs []error
+
+	ports := make([]int, 0, len(s.Servers))
+	for port := range s.Servers {
+		if _, ok := s.httpServers[port]; !ok {
+			ports = append(ports, port)
+		}
+	}
+
+	sort.Ints(ports)
+
+	for _, port := range ports {
+		server := &http.Server{
+			Addr:      fmt.Sprintf(":%v", port),
+			Handler:   s.track(s.portHandler(port)),
+			ConnState: s.connState,
+			ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+				return context.WithValue(ctx, connContextKey{}, c)
+			},
+		}
+
+		l, err := s.listen(port)
+		if err != nil {
+			util.Errorf("listen %v error: %v", server.Addr, err)
+			errs = append(errs, fmt.Errorf("listen %v: %w", server.Addr, err))
+			continue
+		}
+
+		s.httpServers[port] = server
+		s.listeners[port] = l
+
+		util.Infof("listening on %v", server.Addr)
+
+		go func() {
+			if err := server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				util.Errorf("Serve error: %v", err)
+			}
+		}()
+	}
+
+	return errors.Join(errs...)
+}
+
+// portHandler dispatches the request to the container currently registered on the port,
+// so that a reload takes effect on the existing listener.
+func (s *RunningServers) portHandler(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.lock.RLock()
+		c, ok := s.Servers[port]
+		s.lock.RUnlock()
+
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+
+		c.ServeHTTP(w, r)
+	})
+}
+
+func (s *RunningServers) runningHTTPServers() []*http.Server {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	servers := make([]*http.Server, 0, len(s.httpServers))
+	for _, server := range s.httpServers {
+		servers = append(servers, server)
+	}
+
+	return servers
+}
+
+// Shutdown stops accepting new connections and waits for the in-flight requests,
+// including the proxied and hijacked (WebSocket) ones, to complete.
+// When ctx is done before that, the remaining connections are closed forcibly and ctx.Err() is returned.
+func (s *RunningServers) Shutdown(ctx context.Context) error {
+	var wg sync.WaitGroup
+
+	for _, server := range s.runningHTTPServers() {
+		wg.Add(1)
+
+		go func(server *http.Server) {
+			defer wg.Done()
+
+			if err := server.Shutdown(ctx); err != nil {
+				util.Warnf("shutdown %v error: %v", server.Addr, err)
+			}
+		}(server)
+	}
+
+	wg.Wait()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for s.hijackedCount() > 0 {
+		select {
+		case <-ctx.Done():
+			_ = s.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		_ = s.Close()
+		return err
+	}
+
+	return nil
+}
+
+// Close closes all the listeners and connections immediately.
+func (s *RunningServers) Close() error {
+	var lastErr error
+
+	for _, server := range s.runningHTTPServers() {
+		if err := server.Close(); err != nil {
+			lastErr = err
+		}
+	}
+
+	s.hijackedLock.Lock()
+	defer s.hijackedLock.Unlock()
+
+	for c := range s.hijacked {
+		_ = c.Close()
+		delete(s.hijacked, c)
+	}
+
+	return lastErr
+}
+
+func (s *RunningServers) connState(c net.Conn, state http.ConnState) {
+	directive.Connections.ConnState(c, state)
+
+	if state == http.StateHijacked {
+		s.hijackedLock.Lock()
+		s.hijacked[c] = struct{}{}
+		s.hijackedLock.Unlock()
+	}
+}
+
+func (s *RunningServers) hijackedCount() int {
+	s.hijackedLock.Lock()
+	defer s.hijackedLock.Unlock()
+
+	return len(s.hijacked)
+}
+
+// track forgets the hijacked connection once its handler returns,
+// because the connection is released by the handler (e.g. reverse proxy) at that time.
+func (s *RunningServers) track(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if c, ok := r.Context().Value(connContextKey{}).(net.Conn); ok {
+				s.hijackedLock.Lock()
+				delete(s.hijacked, c)
+				s.hijackedLock.Unlock()
+			}
+		}()
+
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,63 @@
+package nginxconf_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/gonginx/nginxconf"
+)
+
+func TestRunningServersReload(t *testing.T) {
+	port := freePort(t)
+	conf := func(text string) []nginxconf.NginxServer {
+		return parseServers(t, fmt.Sprintf(`server { listen %d; location / { echo %s; } }`, port, text))
+	}
+
+	s := startServers(t, fmt.Sprintf(`server { listen %d; location / { echo before; } }`, port))
+	defer s.Close()
+
+	client := &http.Client{Transport: &http.Transport{}}
+	url := fmt.Sprintf("http://127.0.0.1:%d/", port)
+
+	tests := []struct {
+		reload string
+		body   string
+		reused bool
+	}{
+		{body: "before"},
+		{reload: "after", body: "after", reused: true},
+		{reload: "again", body: "again", reused: true},
+	}
+
+	for _, tt := range tests {
+		if tt.reload != "" {
+			s.Reload(conf(tt.reload))
+		}
+
+		reused := false
+		trace := &httptrace.ClientTrace{GotConn: func(info httptrace.GotConnInfo) { reused = info.Reused }}
+		req, _ := http.NewRequest("GET", url, nil)
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+		rsp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("reload %q: %v", tt.reload, err)
+		}
+
+		body, _ := io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+
+		if got := strings.TrimSpace(string(body)); got != tt.body {
+			t.Errorf("reload %q: expected %q, got %q", tt.reload, tt.body, got)
+		}
+
+		// the connection kept alive proves the listener and its server survive the reload.
+		if reused != tt.reused {
+			t.Errorf("reload %q: expected connection reused %v, got %v", tt.reload, tt.reused, reused)
+		}
+	}
+}
@@ -1,14 +1,12 @@
 package nginxconf
 
 import (
-	"fmt"
-	"log"
 	"net"
 	"net/http"
 	"sort"
 	"strings"
 
-	"go.elara.ws/pcre"
+	"github.com/bingoohuang/gonginx/util"
 )
 
 type container struct {
@@ -17,6 +15,14 @@ type container struct {
 	serverNames  []string
 	starStarting []string
 	starEnding   []string
+	// regexNames are the server names of the regular expressions like ~^www\d+\.example\.net$,
+	// compiled by prepare, in the order of the configuration.
+	regexNames []regexName
+}
+
+type regexName struct {
+	name  string
+	regex *util.PCRE
 }
 
 func (c *container) Register(server NginxServer) {
@@ -67,123 +73,101 @@ func (c *container) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		host = h
 	}
 
-	if c.exactMatch(host, w, r) {
-		return
-	}
-
-	if c.wildcardStartingMatch(host, w, r) {
-		return
-	}
-
-	if c.regexMatchInOrderMatch(host, w, r) {
-		return
-	}
-
-	c.defaultHandle(w, r)
+	name, _ := c.find(host)
+	c.dispatch[name].ServeHTTP(w, r)
 }
 
-func (c *container) prepare() {
-	for serverName := range c.dispatch {
-		if strings.HasPrefix(serverName, "*") {
-			c.starStarting = append(c.starStarting, serverName)
-		} else if strings.HasSuffix(serverName, "*") {
-			c.starEnding = append(c.starEnding, serverName)
-		}
-	}
-
-	sort.Slice(c.starStarting, func(i, j int) bool {
-		return len(c.starStarting[i]) > len(c.starStarting[j])
-	})
-	sort.Slice(c.starEnding, func(i, j int) bool {
-		return len(c.starEnding[i]) > len(c.starEnding[j])
-	})
-}
+// The rules to find the server by the host, in the order of precedence.
+const (
+	ruleExact        = "exact name"
+	ruleStarStarting = "wildcard name starting with an asterisk"
+	ruleStarEnding   = "wildcard name ending with an asterisk"
+	ruleRegex        = "regular expression"
+	ruleDefault      = "default server without server_name"
+	ruleFirst        = "the first server on the port"
+)
 
-func (c *container) exactMatch(host string, w http.ResponseWriter, r *http.Request) bool {
-	if h, ok := c.dispatch[host]; ok {
-		h.ServeHTTP(w, r)
-		return true
+// find returns the server name serving the host, and the rule matched.
+func (c *container) find(host string) (string, string) {
+	if _, ok := c.dispatch[host]; ok {
+		return host, ruleExact
 	}
 
-	return false
-}
-
-func (c *container) wildcardStartingMatch(host string, w http.ResponseWriter, r *http.Request) bool {
 	for _, start := range c.starStarting {
 		if strings.HasSuffix(host, start[1:]) {
-			c.dispatch[start].ServeHTTP(w, r)
-			return true
+			return start, ruleStarStarting
 		}
 	}
+
 	for _, end := range c.starEnding {
 		if strings.HasPrefix(host, end[:len(end)-1]) {
-			c.dispatch[end].ServeHTTP(w, r)
-			return true
+			return end, ruleStarEnding
 		}
 	}
 
-	return false
-}
-
-func (c *container) regexMatchInOrderMatch(host string, w http.ResponseWriter, r *http.Request) bool {
-	for _, name := range c.serverNames {
-		p, err := pcre.Compile(name)
-		if err == nil {
-			matched := p.MatchString(host)
-			_ = p.Close()
-			if matched {
-				c.dispatch[name].ServeHTTP(w, r)
-				return true
-			}
+	for _, rn := range c.regexNames {
+		if rn.regex.MatchString(host) {
+			return rn.name, ruleRegex
 		}
 	}
 
-	return false
+	if _, ok := c.dispatch["default_server"]; ok {
+		return "default_server", ruleDefault
+	}
+
+	return c.serverNames[0], ruleFirst
 }
 
-func (c *container) defaultHandle(w http.ResponseWriter, r *http.Request) {
-	if server, ok := c.dispatch["default_server"]; ok {
-		server.ServeHTTP(w, r)
-		return
+// regexMatch tells whether the server name, as a regular expression like ~^www\d+\.example\.net$, matches the host.
+func (c *container) regexMatch(name, host string) bool {
+	for _, rn := range c.regexNames {
+		if rn.name == name {
+			return rn.regex.MatchString(host)
+		}
 	}
 
-	c.dispatch[c.serverNames[0]].ServeHTTP(w, r)
+	return false
 }
 
-type RunningServers struct {
-	Servers map[int]*container
-}
+func (c *container) prepare() {
+	c.close()
+	c.starStarting, c.starEnding = nil, nil
 
-func NewRunningServers() *RunningServers {
-	return &RunningServers{
-		Servers: make(map[int]*container),
-	}
-}
+	for _, serverName := range c.serverNames {
+		if !strings.HasPrefix(serverName, "~") {
+			continue
+		}
 
-func (s *RunningServers) Register(server NginxServer) {
-	c, ok := s.Servers[server.ListenPort]
-	if !ok {
-		c = &container{dispatch: make(map[string]http.Handler)}
-		s.Servers[server.ListenPort] = c
-	}
-	c.Register(server)
-}
+		regex, err := util.CompilePCRE(serverName[1:])
+		if err != nil {
+			util.Warnf("invalid server_name %s: %v", serverName, err)
+			continue
+		}
 
-func (s *RunningServers) Start() {
-	for port, c := range s.Servers {
-		c.prepare()
+		c.regexNames = append(c.regexNames, regexName{name: serverName, regex: regex})
+	}
 
-		server := &http.Server{
-			Addr:    fmt.Sprintf(":%v", port),
-			Handler: c,
+	for serverName := range c.dispatch {
+		if strings.HasPrefix(serverName, "*") {
+			c.starStarting = append(c.starStarting, serverName)
+		} else if strings.HasSuffix(serverName, "*") {
+			c.starEnding = append(c.starEnding, serverName)
 		}
+	}
 
-		log.Printf("listening on %v", server.Addr)
+	sort.Slice(c.starStarting, func(i, j int) bool {
+		return len(c.starStarting[i]) > len(c.starStarting[j])
+	})
+	sort.Slice(c.starEnding, func(i, j int) bool {
+		return len(c.starEnding[i]) > len(c.starEnding[j])
+	})
+}
 
-		go func() {
-			if err := server.ListenAndServe(); err != nil {
-				log.Printf("E! ListenAndServe error: %v", err)
-			}
-		}()
+// close frees the regular expressions of the server names, e.g. when the container is replaced by a reload.
+func (c *container) close() {
+	for _, rn := range c.regexNames {
+		_ = rn.regex.Close()
 	}
+
+	c.regexNames = nil
 }
@@ -0,0 +1,114 @@
+package nginxconf_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gonginx/nginxconf"
+)
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func startServers(t *testing.T, conf string) *nginxconf.RunningServers {
+	block, err := nginxconf.Parse([]byte(conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs := nginxconf.NewRunningServers()
+	for _, server := range block.ParseServers() {
+		rs.Register(server)
+	}
+
+	if err := rs.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	return rs
+}
+
+func TestShutdownDrainsInflightRequests(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		_, _ = io.WriteString(w, "slow")
+	}))
+	defer backend.Close()
+
+	port := freePort(t)
+	rs := startServers(t, fmt.Sprintf(`server { listen %d; location / { proxy_pass %s; } }`, port, backend.URL))
+
+	type result struct {
+		body string
+		err  error
+	}
+
+	done := make(chan result, 1)
+
+	go func() {
+		rsp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/slow", port))
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+
+		defer rsp.Body.Close()
+
+		b, err := io.ReadAll(rsp.Body)
+		done <- result{body: string(b), err: err}
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := rs.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown error: %v", err)
+	}
+
+	if r := <-done; r.err != nil || r.body != "slow" {
+		t.Fatalf("unexpected in-flight result: %+v", r)
+	}
+
+	if _, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/", port)); err == nil {
+		t.Fatal("expected the listener to be closed")
+	}
+}
+
+func TestShutdownTimeoutClosesConnections(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(2 * time.Second)
+	}))
+	defer backend.Close()
+
+	port := freePort(t)
+	rs := startServers(t, fmt.Sprintf(`server { listen %d; location / { proxy_pass %s; } }`, port, backend.URL))
+
+	go func() { _, _ = http.Get(fmt.Sprintf("http://127.0.0.1:%d/", port)) }()
+
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	if err := rs.Shutdown(ctx); err == nil {
+		t.Fatal("expected the shutdown to time out")
+	}
+}
@@ -7,12 +7,29 @@ import (
 )
 
 func (s NginxServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if l := s.Locations.FindLocation(r); l != nil {
-		l.ServeHTTP(w, r)
-		return
+	rw, r := directive.StartRequest(w, r, s.ServerName)
+	rc := directive.GetRequestContext(r)
+	rc.Locations, rc.Named = s.Locations, s.Named
+
+	// the server level rewrites run ahead of the location matching.
+	rc.Location = &s.Default
+	if !s.Default.Rewrite(rw, r) {
+		s.serveLocation(rw, r)
 	}
 
-	if r.URL.Path == "/" {
+	rw.Finish()
+
+	// logs in the location finally serving the request, after the internal redirects.
+	rc.Location.Log(r)
+	directive.Metrics.Observe(r)
+}
+
+func (s NginxServer) serveLocation(w *directive.ResponseWriter, r *http.Request) {
+	if l := s.Locations.FindLocation(r); l != nil {
+		directive.GetRequestContext(r).Location = l
+		directive.ErrorLogOf(r).Debugf("using configuration \"%s\"", l)
+		l.ServeHTTP(w, r)
+	} else if r.URL.Path == "/" {
 		directive.Welcome(w)
 	}
 }
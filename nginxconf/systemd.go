@@ -0,0 +1,96 @@
+package nginxconf
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/bingoohuang/gonginx/util"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd socket activation.
+const listenFdsStart = 3
+
+// loadSystemdListeners adds the sockets passed by systemd socket activation to the inherited listeners.
+// https://www.freedesktop.org/software/systemd/man/sd_listen_fds.html
+func loadSystemdListeners() {
+	for port, l := range systemdListeners(listenFdsStart) {
+		if _, exists := inherited[port]; exists {
+			util.Warnf("duplicate systemd socket on port %d, ignored", port)
+			_ = l.Close()
+			continue
+		}
+
+		inherited[port] = l
+	}
+}
+
+// systemdListeners returns the sockets of LISTEN_FDS from the fd start by the ports of the listen directives.
+// The socket named by a port in LISTEN_FDNAMES, like FileDescriptorName=8080, serves listen 8080
+// whatever it is bound to, and the others serve the listen directives of their own ports.
+// The sockets are ignored with a warning if LISTEN_PID is not the current process,
+// e.g. daemonized by godaemon (DAEMON=true), which should be off with socket activation.
+func systemdListeners(start int) map[int]net.Listener {
+	pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	n, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+
+	if n <= 0 {
+		return nil
+	}
+
+	if pid != os.Getpid() {
+		util.Warnf("LISTEN_PID %d is not the current process %d, systemd sockets ignored", pid, os.Getpid())
+		return nil
+	}
+
+	listeners := make(map[int]net.Listener)
+
+	for i := 0; i < n; i++ {
+		fd := start + i
+		name := fmt.Sprintf("fd%d", fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		syscall.CloseOnExec(fd)
+		f := os.NewFile(uintptr(fd), name)
+		l, err := net.FileListener(f)
+		_ = f.Close()
+
+		if err != nil {
+			util.Warnf("failed to use systemd socket %s: %v", name, err)
+			continue
+		}
+
+		addr, ok := l.Addr().(*net.TCPAddr)
+		if !ok {
+			util.Warnf("systemd socket %s on %v is not a TCP socket, ignored", name, l.Addr())
+			_ = l.Close()
+			continue
+		}
+
+		port := addr.Port
+		if p, err := strconv.Atoi(name); err == nil && p > 0 && p < 65536 {
+			port = p
+		}
+
+		if _, exists := listeners[port]; exists {
+			util.Warnf("duplicate systemd socket %s on port %d, ignored", name, port)
+			_ = l.Close()
+			continue
+		}
+
+		util.Infof("systemd socket %s on %v for listen %d", name, l.Addr(), port)
+		listeners[port] = l
+	}
+
+	return listeners
+}
@@ -0,0 +1,66 @@
+package nginxconf_test
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/bingoohuang/gonginx/nginxconf"
+)
+
+func TestSystemdListeners(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+
+	port := l.Addr().(*net.TCPAddr).Port
+	pid := strconv.Itoa(os.Getpid())
+
+	tests := []struct {
+		pid, fds, names string
+		port            int
+	}{
+		{pid: pid, fds: "1", port: port},
+		{pid: pid, fds: "1", names: "web", port: port},
+		// the name of a port matches the listen directive of it, not the port bound.
+		{pid: pid, fds: "1", names: "18080", port: 18080},
+		{pid: pid, fds: "0"},
+		// e.g. passed to the parent before daemonized.
+		{pid: "1", fds: "1"},
+	}
+
+	for _, tt := range tests {
+		fd := listenerFd(t, l)
+		t.Setenv("LISTEN_PID", tt.pid)
+		t.Setenv("LISTEN_FDS", tt.fds)
+		t.Setenv("LISTEN_FDNAMES", tt.names)
+
+		listeners := nginxconf.SystemdListeners(fd)
+		if tt.port == 0 {
+			_ = syscall.Close(fd)
+
+			if len(listeners) != 0 {
+				t.Errorf("%+v: expected no listeners, got %v", tt, listeners)
+			}
+
+			continue
+		}
+
+		if sl := listeners[tt.port]; len(listeners) != 1 || sl == nil || sl.Addr().String() != l.Addr().String() {
+			t.Errorf("%+v: expected the listener on %s for port %d, got %v", tt, l.Addr(), tt.port, listeners)
+		}
+
+		for _, sl := range listeners {
+			_ = sl.Close()
+		}
+
+		if os.Getenv("LISTEN_FDS") != "" {
+			t.Errorf("%+v: expected the environment unset", tt)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package nginxconf_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTryFiles(t *testing.T) {
+	root := t.TempDir()
+	_ = os.WriteFile(filepath.Join(root, "index.html"), []byte("spa"), 0o644)
+	_ = os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o644)
+
+	servers := parseServers(t, fmt.Sprintf(`
+server {
+    listen 15008;
+    root %s;
+    location / { try_files $uri $uri/ /index.html; }
+    location /api { try_files $uri @backend; }
+    location @backend { echo backend; }
+    location /missing { try_files $uri =404; }
+    location /loop { try_files $uri /loop; }
+}`, root))
+
+	tests := []struct {
+		uri, body string
+		status    int
+	}{
+		{uri: "/a.txt", body: "a", status: 200},
+		{uri: "/app/route", body: "spa", status: 200},
+		{uri: "/api/users", body: "backend\n", status: 200},
+		{uri: "/missing/x", status: 404},
+		{uri: "/loop/x", status: 500},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		servers[0].ServeHTTP(w, httptest.NewRequest("GET", tt.uri, nil))
+
+		if w.Code != tt.status || w.Body.String() != tt.body {
+			t.Errorf("%s: unexpected %d %q", tt.uri, w.Code, w.Body.String())
+		}
+	}
+}
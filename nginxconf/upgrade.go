@@ -0,0 +1,195 @@
+package nginxconf
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bingoohuang/gonginx/util"
+)
+
+const (
+	// envListeners passes the inherited listeners to the upgraded process, like "15001:3;15002:4",
+	// which means port 15001 is listened on fd 3 and port 15002 on fd 4.
+	envListeners = "GONGINX_LISTENERS"
+	// envParentPid passes the pid of the process which started the upgraded process.
+	envParentPid = "GONGINX_PARENT_PID"
+)
+
+var (
+	inheritedOnce sync.Once
+	inheritedLock sync.Mutex
+	inherited     map[int]net.Listener
+	parentPid     int
+)
+
+// loadInherited parses the listeners passed by the parent process on binary upgrade,
+// or by systemd socket activation.
+func loadInherited() {
+	inheritedOnce.Do(func() {
+		parentPid, _ = strconv.Atoi(os.Getenv(envParentPid))
+
+		env := os.Getenv(envListeners)
+		_ = os.Unsetenv(envListeners)
+		_ = os.Unsetenv(envParentPid)
+
+		inherited = parseListeners(env)
+		loadSystemdListeners()
+	})
+}
+
+// parseListeners parses the listeners of GONGINX_LISTENERS, like "15001:3;15002:4", the invalid items are ignored.
+func parseListeners(env string) map[int]net.Listener {
+	listeners := make(map[int]net.Listener)
+
+	for _, item := range strings.Split(env, ";") {
+		portFd := strings.SplitN(item, ":", 2)
+		if len(portFd) != 2 {
+			continue
+		}
+
+		port, err1 := strconv.Atoi(portFd[0])
+		fd, err2 := strconv.Atoi(portFd[1])
+		if err1 != nil || err2 != nil {
+			util.Warnf("invalid inherited listener %q", item)
+			continue
+		}
+
+		f := os.NewFile(uintptr(fd), fmt.Sprintf("listener:%d", port))
+		l, err := net.FileListener(f)
+		_ = f.Close()
+
+		if err != nil {
+			util.Warnf("failed to inherit listener %q: %v", item, err)
+			continue
+		}
+
+		util.Infof("inherited listener on :%d", port)
+		listeners[port] = l
+	}
+
+	return listeners
+}
+
+// UpgradeParent returns the pid of the process which handed over its listeners to us, 0 if none.
+func UpgradeParent() int {
+	loadInherited()
+	return parentPid
+}
+
+func takeInherited(port int) net.Listener {
+	loadInherited()
+
+	inheritedLock.Lock()
+	defer inheritedLock.Unlock()
+
+	l, ok := inherited[port]
+	if ok {
+		delete(inherited, port)
+	}
+
+	return l
+}
+
+// closeInheritedListeners closes the inherited listeners which are no longer configured.
+func closeInheritedListeners() {
+	loadInherited()
+
+	inheritedLock.Lock()
+	defer inheritedLock.Unlock()
+
+	for port, l := range inherited {
+		util.Infof("close inherited listener on :%d which is not configured", port)
+		_ = l.Close()
+		delete(inherited, port)
+	}
+}
+
+// listen returns the listener on the port, reusing the inherited one when available.
+func (s *RunningServers) listen(port int) (net.Listener, error) {
+	if l := takeInherited(port); l != nil {
+		return l, nil
+	}
+
+	return net.Listen("tcp", fmt.Sprintf(":%v", port))
+}
+
+// Upgrade starts the new binary (the same path as the current one) and hands over the listening sockets to it,
+// like nginx's USR2 upgrade. The new process sends QUIT to the current process after it starts serving,
+// so that the current one drains and exits.
+func (s *RunningServers) Upgrade() (*os.Process, error) {
+	path, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to find executable %s: %w", os.Args[0], err)
+	}
+
+	s.lock.RLock()
+	ports := make([]int, 0, len(s.listeners))
+	for port := range s.listeners {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+
+	files := make([]*os.File, 0, len(ports))
+	items := make([]string, 0, len(ports))
+	for _, port := range ports {
+		f, err := s.listeners[port].(interface{ File() (*os.File, error) }).File()
+		if err != nil {
+			s.lock.RUnlock()
+			closeFiles(files)
+			return nil, fmt.Errorf("failed to get file of listener on :%d: %w", port, err)
+		}
+
+		// ExtraFiles[i] becomes fd 3+i in the child process.
+		items = append(items, fmt.Sprintf("%d:%d", port, 3+len(files)))
+		files = append(files, f)
+	}
+	s.lock.RUnlock()
+
+	defer closeFiles(files)
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(upgradeEnviron(),
+		envListeners+"="+strings.Join(items, ";"),
+		fmt.Sprintf("%s=%d", envParentPid, os.Getpid()))
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", path, err)
+	}
+
+	go func() { _ = cmd.Wait() }()
+
+	return cmd.Process, nil
+}
+
+// upgradeEnviron returns the environment for the upgraded process,
+// without the daemon markers, because the current process is already daemonized
+// and the listeners can not survive another daemonizing.
+func upgradeEnviron() []string {
+	env := make([]string, 0, len(os.Environ()))
+
+	for _, e := range os.Environ() {
+		switch {
+		case strings.HasPrefix(e, "DAEMON="), strings.HasPrefix(e, "_GO_DAEMON="),
+			strings.HasPrefix(e, envListeners+"="), strings.HasPrefix(e, envParentPid+"="):
+			continue
+		}
+
+		env = append(env, e)
+	}
+
+	return env
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		_ = f.Close()
+	}
+}
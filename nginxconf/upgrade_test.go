@@ -0,0 +1,130 @@
+package nginxconf_test
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/bingoohuang/gonginx/nginxconf"
+)
+
+// listenerFd returns a duplicated fd of the listener, as passed to the upgraded process.
+func listenerFd(t *testing.T, l net.Listener) int {
+	t.Helper()
+
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fd
+}
+
+func TestParseListeners(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+
+	port := l.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		env   string
+		ports []int
+	}{
+		{env: ""},
+		{env: "15001"},
+		{env: "x:3;15001:y"},
+		{env: "15001:99999"},
+		{env: fmt.Sprintf("%d:%d", port, listenerFd(t, l)), ports: []int{port}},
+		{env: fmt.Sprintf("bad;%d:%d;15001:99999", port, listenerFd(t, l)), ports: []int{port}},
+	}
+
+	for _, tt := range tests {
+		listeners := nginxconf.ParseListeners(tt.env)
+		if len(listeners) != len(tt.ports) {
+			t.Errorf("%q: expected %d listeners, got %d", tt.env, len(tt.ports), len(listeners))
+		}
+
+		for _, p := range tt.ports {
+			if addr := listeners[p].Addr().String(); addr != l.Addr().String() {
+				t.Errorf("%q: expected listener on %s, got %s", tt.env, l.Addr(), addr)
+			}
+		}
+
+		for _, inherited := range listeners {
+			_ = inherited.Close()
+		}
+	}
+}
+
+func TestTakeInherited(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+
+	port := l.Addr().(*net.TCPAddr).Port
+	inherited := nginxconf.ParseListeners(fmt.Sprintf("%d:%d", port, listenerFd(t, l)))
+	nginxconf.SetInherited(inherited)
+
+	// the port is still listened by l, so the servers work only on the inherited listener.
+	rs := startServers(t, fmt.Sprintf(`server { listen %d; location / { echo inherited; } }`, port))
+	defer rs.Close()
+
+	rsp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+
+	if got := strings.TrimSpace(string(body)); got != "inherited" {
+		t.Errorf("expected inherited, got %q", got)
+	}
+
+	if taken := nginxconf.TakeInherited(port); taken != nil {
+		t.Errorf("expected the inherited listener taken once, got %v", taken.Addr())
+	}
+}
+
+func TestStartListenError(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+
+	block, err := nginxconf.Parse([]byte(fmt.Sprintf(`server { listen %d; }`, l.Addr().(*net.TCPAddr).Port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs := nginxconf.NewRunningServers()
+	for _, server := range block.ParseServers() {
+		rs.Register(server)
+	}
+
+	defer rs.Close()
+
+	if err := rs.Start(); err == nil || !strings.Contains(err.Error(), "address already in use") {
+		t.Errorf("expected address already in use, got %v", err)
+	}
+}
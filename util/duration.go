@@ -0,0 +1,66 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationUnits = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+	"M":  30 * 24 * time.Hour,
+	"y":  365 * 24 * time.Hour,
+}
+
+// ParseDuration parses the time interval in nginx syntax, like 30s, 1h30m or 500ms.
+// A number without unit is treated as seconds.
+// http://nginx.org/en/docs/syntax.html
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.ReplaceAll(s, " ", "")
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+
+	var d time.Duration
+
+	for s != "" {
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+
+		if i == 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+
+		n, _ := strconv.ParseInt(s[:i], 10, 64)
+		s = s[i:]
+
+		j := 0
+		for j < len(s) && (s[j] < '0' || s[j] > '9') {
+			j++
+		}
+
+		unit := s[:j]
+		s = s[j:]
+
+		if unit == "" {
+			unit = "s"
+		}
+
+		u, ok := durationUnits[unit]
+		if !ok {
+			return 0, fmt.Errorf("invalid duration unit %q", unit)
+		}
+
+		d += time.Duration(n) * u
+	}
+
+	return d, nil
+}
@@ -0,0 +1,31 @@
+package util_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gonginx/util"
+)
+
+func TestParseDuration(t *testing.T) {
+	cases := map[string]time.Duration{
+		"30":     30 * time.Second,
+		"30s":    30 * time.Second,
+		"500ms":  500 * time.Millisecond,
+		"1h30m":  90 * time.Minute,
+		"1h 30m": 90 * time.Minute,
+		"2d":     48 * time.Hour,
+	}
+
+	for s, expected := range cases {
+		if d, err := util.ParseDuration(s); err != nil || d != expected {
+			t.Errorf("ParseDuration(%q) = %v, %v, expected %v", s, d, err, expected)
+		}
+	}
+
+	for _, s := range []string{"", "s", "10x"} {
+		if _, err := util.ParseDuration(s); err == nil {
+			t.Errorf("ParseDuration(%q) expected error", s)
+		}
+	}
+}
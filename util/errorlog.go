@@ -0,0 +1,273 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/golog/pkg/logfmt"
+	"github.com/bingoohuang/golog/pkg/rotate"
+	"github.com/bingoohuang/golog/pkg/term"
+	"github.com/sirupsen/logrus"
+)
+
+// Level is the level of the error log.
+// http://nginx.org/en/docs/ngx_core_module.html#error_log
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelNotice
+	LevelWarn
+	LevelError
+	LevelCrit
+	LevelAlert
+	LevelEmerg
+)
+
+var levelNames = []string{"debug", "info", "notice", "warn", "error", "crit", "alert", "emerg"}
+
+func (l Level) String() string { return levelNames[l] }
+
+// ParseLevel parses the level name, like warn.
+func ParseLevel(s string) (Level, bool) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), true
+		}
+	}
+
+	return LevelError, false
+}
+
+// tag returns the golog level tag of the level.
+func (l Level) tag() string {
+	switch {
+	case l == LevelDebug:
+		return "D! "
+	case l <= LevelNotice:
+		return "I! "
+	case l == LevelWarn:
+		return "W! "
+	default:
+		return "E! "
+	}
+}
+
+func (l Level) logrusLevel() logrus.Level {
+	switch {
+	case l == LevelDebug:
+		return logrus.DebugLevel
+	case l <= LevelNotice:
+		return logrus.InfoLevel
+	case l == LevelWarn:
+		return logrus.WarnLevel
+	default:
+		return logrus.ErrorLevel
+	}
+}
+
+// ErrorOutput is an output of the error log, the Writer nil means the main error log.
+type ErrorOutput struct {
+	Level  Level
+	Writer io.Writer
+}
+
+// ErrorLog writes the leveled logs into the outputs, like the error_log directives in the same level.
+// The zero value writes into the main error log.
+type ErrorLog struct {
+	Outputs []ErrorOutput
+	// Context is appended to the messages, like ", client: 127.0.0.1, server: a.com".
+	Context string
+}
+
+// With returns a copy of the error log with the context appended to the messages.
+func (e ErrorLog) With(context string) ErrorLog {
+	e.Context += context
+	return e
+}
+
+// Enabled tells whether the level is enabled in any output.
+func (e ErrorLog) Enabled(level Level) bool {
+	if len(e.Outputs) == 0 {
+		return logrus.IsLevelEnabled(level.logrusLevel())
+	}
+
+	for _, o := range e.Outputs {
+		if o.Level <= level {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Logf writes the message with the level.
+func (e ErrorLog) Logf(level Level, format string, v ...interface{}) {
+	if len(e.Outputs) == 0 {
+		if e.Enabled(level) {
+			log.Printf(level.tag()+format+"%s", append(v, e.Context)...)
+		}
+		return
+	}
+
+	var msg string
+
+	for _, o := range e.Outputs {
+		if level < o.Level {
+			continue
+		}
+
+		if o.Writer == nil {
+			log.Printf(level.tag()+format+"%s", append(v, e.Context)...)
+			continue
+		}
+
+		if msg == "" {
+			// the nginx error log format, like 2006/01/02 15:04:05 [error] 1234#0: message
+			msg = fmt.Sprintf("%s [%s] %d#0: %s%s\n", time.Now().Format("2006/01/02 15:04:05"),
+				level, os.Getpid(), fmt.Sprintf(format, v...), e.Context)
+		}
+
+		if s, ok := o.Writer.(*Syslog); ok {
+			_ = s.WriteLevel(level, msg)
+		} else {
+			_, _ = io.WriteString(o.Writer, msg)
+		}
+	}
+}
+
+func (e ErrorLog) Debugf(format string, v ...interface{}) { e.Logf(LevelDebug, format, v...) }
+func (e ErrorLog) Infof(format string, v ...interface{})  { e.Logf(LevelInfo, format, v...) }
+func (e ErrorLog) Warnf(format string, v ...interface{})  { e.Logf(LevelWarn, format, v...) }
+func (e ErrorLog) Errorf(format string, v ...interface{}) { e.Logf(LevelError, format, v...) }
+
+// Debugf writes the debug message into the main error log.
+func Debugf(format string, v ...interface{}) { ErrorLog{}.Debugf(format, v...) }
+
+// Infof writes the info message into the main error log.
+func Infof(format string, v ...interface{}) { ErrorLog{}.Infof(format, v...) }
+
+// Warnf writes the warn message into the main error log.
+func Warnf(format string, v ...interface{}) { ErrorLog{}.Warnf(format, v...) }
+
+// Errorf writes the error message into the main error log.
+func Errorf(format string, v ...interface{}) { ErrorLog{}.Errorf(format, v...) }
+
+var (
+	errorLogLock    sync.Mutex
+	errorLogWriters = make(map[string]io.Writer)
+)
+
+// OpenErrorLogWriter opens the error log target, which is shared by the same target,
+// the target is a file path, stderr or syslog:server=address[,facility=..][,tag=..].
+func OpenErrorLogWriter(target string, option RotateOption) (io.Writer, error) {
+	errorLogLock.Lock()
+	defer errorLogLock.Unlock()
+
+	if w, ok := errorLogWriters[target]; ok {
+		return w, nil
+	}
+
+	var (
+		w   io.Writer
+		err error
+	)
+
+	switch {
+	case target == "stderr":
+		w = os.Stderr
+	case strings.HasPrefix(target, "syslog:"):
+		w, err = OpenSyslog(strings.TrimPrefix(target, "syslog:"))
+	default:
+		w, err = OpenRotateFile(target, option)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	errorLogWriters[target] = w
+
+	return w, nil
+}
+
+// SetupErrorLog directs the golog main error log to the target with the level,
+// instead of the default file created by golog.
+func SetupErrorLog(target string, level Level, option RotateOption) error {
+	w, err := OpenErrorLogWriter(target, option)
+	if err != nil {
+		return err
+	}
+
+	lw := rotate.WrapLevelWriter(w)
+	if s, ok := w.(*Syslog); ok {
+		lw = syslogLevelWriter{Syslog: s}
+	}
+
+	formatter := &logfmt.LogrusFormatter{Formatter: logfmt.Formatter{}}
+	writers := []*rotate.WriterFormatter{{LevelWriter: lw, Formatter: formatter}}
+
+	if term.IsTerminal() && target != "stderr" {
+		writers = append(writers, &rotate.WriterFormatter{
+			LevelWriter: rotate.WrapLevelWriter(os.Stdout),
+			Formatter:   &logfmt.LogrusFormatter{Formatter: logfmt.Formatter{PrintColor: true}},
+		})
+	}
+
+	hooks := make(logrus.LevelHooks)
+	hooks.Add(logfmt.NewHook(writers))
+	logrus.StandardLogger().ReplaceHooks(hooks)
+	logrus.SetLevel(level.logrusLevel())
+
+	return nil
+}
+
+// syslogLevelWriter sends the golog messages to the syslog with the severities of their levels.
+type syslogLevelWriter struct {
+	*Syslog
+}
+
+func (s syslogLevelWriter) Write(level logrus.Level, p []byte) (int, error) {
+	l := LevelError
+
+	switch level {
+	case logrus.TraceLevel, logrus.DebugLevel:
+		l = LevelDebug
+	case logrus.InfoLevel:
+		l = LevelInfo
+	case logrus.WarnLevel:
+		l = LevelWarn
+	case logrus.FatalLevel, logrus.PanicLevel:
+		l = LevelCrit
+	}
+
+	if err := s.WriteLevel(l, string(p)); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// ReopenErrorLog reopens the error log files, and reconnects the syslog servers.
+func ReopenErrorLog() error {
+	errorLogLock.Lock()
+	defer errorLogLock.Unlock()
+
+	var lastErr error
+
+	for _, w := range errorLogWriters {
+		if f, ok := w.(interface{ Reopen() error }); ok {
+			if err := f.Reopen(); err != nil {
+				lastErr = err
+			}
+		}
+	}
+
+	return lastErr
+}
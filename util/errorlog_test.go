@@ -0,0 +1,45 @@
+package util_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/gonginx/util"
+)
+
+func TestParseLevel(t *testing.T) {
+	if l, ok := util.ParseLevel("WARN"); !ok || l != util.LevelWarn {
+		t.Errorf("ParseLevel(WARN) = %v, %v", l, ok)
+	}
+
+	if _, ok := util.ParseLevel("rotate=daily"); ok {
+		t.Error("ParseLevel(rotate=daily) should fail")
+	}
+}
+
+func TestErrorLogLevels(t *testing.T) {
+	var info, errs bytes.Buffer
+
+	el := util.ErrorLog{Outputs: []util.ErrorOutput{
+		{Level: util.LevelInfo, Writer: &info},
+		{Level: util.LevelError, Writer: &errs},
+	}}.With(", server: a.com")
+
+	el.Debugf("debug %d", 1)
+	el.Infof("info %d", 2)
+	el.Errorf("error %d", 3)
+
+	if s := info.String(); strings.Contains(s, "debug") || !strings.Contains(s, "[info]") ||
+		!strings.Contains(s, "#0: error 3, server: a.com\n") {
+		t.Errorf("unexpected info output %q", s)
+	}
+
+	if s := errs.String(); strings.Count(s, "\n") != 1 || !strings.Contains(s, "[error]") {
+		t.Errorf("unexpected error output %q", s)
+	}
+
+	if el.Enabled(util.LevelDebug) || !el.Enabled(util.LevelInfo) {
+		t.Error("unexpected Enabled")
+	}
+}
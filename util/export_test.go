@@ -0,0 +1,4 @@
+package util
+
+// IntervalElapsed exports the time-based rotation check for the tests.
+var IntervalElapsed = intervalElapsed
@@ -0,0 +1,197 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Htpasswd is the Apache htpasswd file, like user:password lines,
+// the password is bcrypt ($2y$), {SHA}, $apr1$ MD5, or plain text with {PLAIN},
+// the passwords of the other schemes, like crypt(3), never match.
+// The file is loaded again when it changes.
+type Htpasswd struct {
+	Path string
+
+	lock    sync.Mutex
+	modTime time.Time
+	size    int64
+	users   map[string]string
+}
+
+// Verify tells whether the user exists in the file and whether the password matches.
+func (h *Htpasswd) Verify(user, password string) (found, matched bool, err error) {
+	hash, found, err := h.lookup(user)
+	if err != nil || !found {
+		return found, false, err
+	}
+
+	matched, supported := checkPassword(hash, password)
+	if !supported {
+		Warnf("unsupported password scheme for user %q in %q", user, h.Path)
+	}
+
+	return true, matched, nil
+}
+
+func (h *Htpasswd) lookup(user string) (string, bool, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	fi, err := os.Stat(h.Path)
+	if err != nil {
+		return "", false, err
+	}
+
+	if h.users == nil || !fi.ModTime().Equal(h.modTime) || fi.Size() != h.size {
+		data, err := os.ReadFile(h.Path)
+		if err != nil {
+			return "", false, err
+		}
+
+		h.users, h.modTime, h.size = parseHtpasswd(data), fi.ModTime(), fi.Size()
+	}
+
+	hash, ok := h.users[user]
+
+	return hash, ok, nil
+}
+
+func parseHtpasswd(data []byte) map[string]string {
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if user, hash, ok := strings.Cut(line, ":"); ok {
+			// the fields after the password, like the comments of htdigest, are ignored.
+			hash, _, _ = strings.Cut(hash, ":")
+			users[user] = hash
+		}
+	}
+
+	return users
+}
+
+// CheckPassword tells whether the password matches the hash of htpasswd, false for the unsupported schemes.
+func CheckPassword(hash, password string) bool {
+	matched, _ := checkPassword(hash, password)
+	return matched
+}
+
+func checkPassword(hash, password string) (matched, supported bool) {
+	var expected string
+
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil, true
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		expected = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	case strings.HasPrefix(hash, "$apr1$"):
+		salt, _, _ := strings.Cut(strings.TrimPrefix(hash, "$apr1$"), "$")
+		expected = APR1(password, salt)
+	case strings.HasPrefix(hash, "{PLAIN}"):
+		expected = "{PLAIN}" + password
+	default:
+		// like crypt(3) and the plain text without {PLAIN}, never compared as is.
+		return false, false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(expected)) == 1, true
+}
+
+// APR1 returns the Apache MD5 crypt of the password, like $apr1$salt$hash.
+func APR1(password, salt string) string {
+	const magic = "$apr1$"
+
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+
+	pw := []byte(password)
+
+	alt := md5.New()
+	alt.Write(pw)
+	alt.Write([]byte(salt))
+	alt.Write(pw)
+	altSum := alt.Sum(nil)
+
+	ctx := md5.New()
+	ctx.Write(pw)
+	ctx.Write([]byte(magic + salt))
+
+	for i := len(pw); i > 0; i -= 16 {
+		ctx.Write(altSum[:min(i, 16)])
+	}
+
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(pw[:1])
+		}
+	}
+
+	sum := ctx.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+
+		if i&1 == 1 {
+			round.Write(pw)
+		} else {
+			round.Write(sum)
+		}
+
+		if i%3 != 0 {
+			round.Write([]byte(salt))
+		}
+
+		if i%7 != 0 {
+			round.Write(pw)
+		}
+
+		if i&1 == 1 {
+			round.Write(sum)
+		} else {
+			round.Write(pw)
+		}
+
+		sum = round.Sum(nil)
+	}
+
+	var b strings.Builder
+
+	b.WriteString(magic + salt + "$")
+
+	for _, g := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		to64(&b, uint(sum[g[0]])<<16|uint(sum[g[1]])<<8|uint(sum[g[2]]), 4)
+	}
+
+	to64(&b, uint(sum[11]), 2)
+
+	return b.String()
+}
+
+func to64(b *strings.Builder, v uint, n int) {
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+	for ; n > 0; n-- {
+		b.WriteByte(itoa64[v&0x3f])
+		v >>= 6
+	}
+}
@@ -0,0 +1,64 @@
+package util_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gonginx/util"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAPR1(t *testing.T) {
+	// openssl passwd -apr1 -salt saltsalt secret
+	if got := util.APR1("secret", "saltsalt"); got != "$apr1$saltsalt$LrttParrLPdxvgutaSXWJ0" {
+		t.Errorf("unexpected %s", got)
+	}
+
+	if got := util.APR1("x", "ab"); got != "$apr1$ab$eIePjsejfBGR8ITtu2z0U1" {
+		t.Errorf("unexpected %s", got)
+	}
+}
+
+func TestHtpasswd(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("b-pass"), bcrypt.MinCost)
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	content := "# users\n" +
+		"bob:" + string(hash) + "\n" +
+		"sha:{SHA}qUqP5cyxm6YcTAhz05Hph5gvu9M=\n" + // test
+		"apr:$apr1$saltsalt$LrttParrLPdxvgutaSXWJ0\n" +
+		"plain:{PLAIN}p\n" +
+		"bare:bare-pass\n"
+	_ = os.WriteFile(path, []byte(content), 0o600)
+
+	h := &util.Htpasswd{Path: path}
+
+	tests := []struct {
+		user, password string
+		found, matched bool
+	}{
+		{user: "bob", password: "b-pass", found: true, matched: true},
+		{user: "bob", password: "wrong", found: true},
+		{user: "sha", password: "test", found: true, matched: true},
+		{user: "apr", password: "secret", found: true, matched: true},
+		{user: "apr", password: "secreT", found: true},
+		{user: "plain", password: "p", found: true, matched: true},
+		{user: "bare", password: "bare-pass", found: true},
+		{user: "nobody", password: "x"},
+	}
+
+	for _, tt := range tests {
+		found, matched, err := h.Verify(tt.user, tt.password)
+		if err != nil || found != tt.found || matched != tt.matched {
+			t.Errorf("%s/%s: unexpected found %v, matched %v, error %v", tt.user, tt.password, found, matched, err)
+		}
+	}
+
+	_ = os.WriteFile(path, []byte("nobody:{PLAIN}x\n"), 0o600)
+	_ = os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+
+	if found, matched, _ := h.Verify("nobody", "x"); !found || !matched {
+		t.Error("expected the file reloaded")
+	}
+}
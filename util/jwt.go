@@ -0,0 +1,403 @@
+package util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWTKey is a key to verify the JWT signatures, a public key of RSA or ECDSA, or a secret of HMAC.
+type JWTKey struct {
+	ID     string
+	Public crypto.PublicKey
+	Secret []byte
+}
+
+// JWTKeys are the keys of the file, in PEM, like the public keys and the certificates,
+// or in JWKS, like {"keys":[{"kty":"RSA",...}]}, with the secrets of HMAC as the kty oct keys.
+// The file is loaded again when it changes.
+type JWTKeys struct {
+	Path string
+
+	lock    sync.Mutex
+	modTime time.Time
+	size    int64
+	keys    []JWTKey
+}
+
+// JWT is the token verified.
+type JWT struct {
+	Header map[string]any
+	Claims map[string]any
+}
+
+// ErrJWTInvalid is the error of the tokens malformed, or with the signatures unverified.
+var ErrJWTInvalid = errors.New("invalid token")
+
+// Load returns the keys of the file.
+func (k *JWTKeys) Load() ([]JWTKey, error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	fi, err := os.Stat(k.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if k.keys == nil || !fi.ModTime().Equal(k.modTime) || fi.Size() != k.size {
+		data, err := os.ReadFile(k.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		keys, err := ParseJWTKeys(data)
+		if err != nil {
+			return nil, err
+		}
+
+		k.keys, k.modTime, k.size = keys, fi.ModTime(), fi.Size()
+	}
+
+	return k.keys, nil
+}
+
+// ParseJWTKeys parses the keys in JWKS or in PEM.
+func ParseJWTKeys(data []byte) ([]JWTKey, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return parseJWKS(trimmed)
+	}
+
+	var keys []JWTKey
+
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+
+			keys = append(keys, JWTKey{Public: cert.PublicKey})
+		case "RSA PUBLIC KEY":
+			pub, err := x509.ParsePKCS1PublicKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+
+			keys = append(keys, JWTKey{Public: pub})
+		default:
+			pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("unsupported PEM block %s: %w", block.Type, err)
+			}
+
+			keys = append(keys, JWTKey{Public: pub})
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no keys found")
+	}
+
+	return keys, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+func parseJWKS(data []byte) ([]JWTKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make([]JWTKey, 0, len(set.Keys))
+
+	for _, j := range set.Keys {
+		key, err := j.key()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", j.Kid, err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no keys found")
+	}
+
+	return keys, nil
+}
+
+func (j jwk) key() (JWTKey, error) {
+	key := JWTKey{ID: j.Kid}
+	enc := base64.RawURLEncoding
+
+	switch j.Kty {
+	case "oct":
+		secret, err := enc.DecodeString(j.K)
+		if err != nil {
+			return key, err
+		}
+
+		key.Secret = secret
+	case "RSA":
+		n, err := enc.DecodeString(j.N)
+		if err != nil {
+			return key, err
+		}
+
+		e, err := enc.DecodeString(j.E)
+		if err != nil {
+			return key, err
+		}
+
+		key.Public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case "EC":
+		var curve elliptic.Curve
+
+		switch j.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return key, fmt.Errorf("unsupported curve %q", j.Crv)
+		}
+
+		x, err := enc.DecodeString(j.X)
+		if err != nil {
+			return key, err
+		}
+
+		y, err := enc.DecodeString(j.Y)
+		if err != nil {
+			return key, err
+		}
+
+		key.Public = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	default:
+		return key, fmt.Errorf("unsupported kty %q", j.Kty)
+	}
+
+	return key, nil
+}
+
+// ParseJWT parses the compact JWT, and verifies its signature by the keys, the one of the kid if specified.
+// The claims, like exp, are not validated, see JWT.Validate.
+func ParseJWT(token string, keys []JWTKey) (*JWT, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrJWTInvalid
+	}
+
+	var t JWT
+
+	if err := decodeJWTPart(parts[0], &t.Header); err != nil {
+		return nil, err
+	}
+
+	if err := decodeJWTPart(parts[1], &t.Claims); err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrJWTInvalid
+	}
+
+	alg, _ := t.Header["alg"].(string)
+	kid, _ := t.Header["kid"].(string)
+	signed := []byte(parts[0] + "." + parts[1])
+
+	for _, key := range keys {
+		if kid != "" && key.ID != "" && key.ID != kid {
+			continue
+		}
+
+		if ok, err := verifyJWT(alg, key, signed, sig); err != nil {
+			return nil, err
+		} else if ok {
+			return &t, nil
+		}
+	}
+
+	return nil, ErrJWTInvalid
+}
+
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return ErrJWTInvalid
+	}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	if err := d.Decode(v); err != nil {
+		return ErrJWTInvalid
+	}
+
+	return nil
+}
+
+func verifyJWT(alg string, key JWTKey, signed, sig []byte) (bool, error) {
+	var hash crypto.Hash
+
+	switch alg[min(len(alg), 2):] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return false, fmt.Errorf("unsupported alg %q", alg)
+	}
+
+	switch strings.TrimRight(alg, "0123456789") {
+	case "HS":
+		if key.Secret == nil {
+			return false, nil
+		}
+
+		mac := hmac.New(hash.New, key.Secret)
+		mac.Write(signed)
+
+		return hmac.Equal(mac.Sum(nil), sig), nil
+	case "RS":
+		pub, ok := key.Public.(*rsa.PublicKey)
+		if !ok {
+			return false, nil
+		}
+
+		h := hash.New()
+		h.Write(signed)
+
+		return rsa.VerifyPKCS1v15(pub, hash, h.Sum(nil), sig) == nil, nil
+	case "ES":
+		pub, ok := key.Public.(*ecdsa.PublicKey)
+		if !ok {
+			return false, nil
+		}
+
+		// the signature is r and s in the fixed size of the curve.
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return false, nil
+		}
+
+		h := hash.New()
+		h.Write(signed)
+
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+
+		return ecdsa.Verify(pub, h.Sum(nil), r, s), nil
+	default:
+		return false, fmt.Errorf("unsupported alg %q", alg)
+	}
+}
+
+// Validate validates the claims exp and nbf by the time now, and iss and aud if not empty.
+func (t *JWT) Validate(now time.Time, issuer, audience string) error {
+	if exp, ok := t.Claims["exp"].(json.Number); ok {
+		if v, err := exp.Float64(); err != nil || now.Unix() >= int64(v) {
+			return errors.New("token expired")
+		}
+	}
+
+	if nbf, ok := t.Claims["nbf"].(json.Number); ok {
+		if v, err := nbf.Float64(); err != nil || now.Unix() < int64(v) {
+			return errors.New("token not yet valid")
+		}
+	}
+
+	if iss, _ := t.Claims["iss"].(string); issuer != "" && iss != issuer {
+		return fmt.Errorf("issuer %q mismatch", iss)
+	}
+
+	if audience != "" && !t.hasAudience(audience) {
+		return fmt.Errorf("audience %q mismatch", audience)
+	}
+
+	return nil
+}
+
+func (t *JWT) hasAudience(audience string) bool {
+	switch aud := t.Claims["aud"].(type) {
+	case string:
+		return aud == audience
+	case []any:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Claim returns the claim as the string, the arrays joined by commas, and the objects in JSON.
+func (t *JWT) Claim(name string) (string, bool) {
+	return jwtValue(t.Claims[name])
+}
+
+// HeaderValue returns the header field as the string, like alg and kid.
+func (t *JWT) HeaderValue(name string) (string, bool) {
+	return jwtValue(t.Header[name])
+}
+
+func jwtValue(v any) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, e := range v {
+			s, _ := jwtValue(e)
+			values = append(values, s)
+		}
+
+		return strings.Join(values, ","), true
+	default:
+		data, _ := json.Marshal(v)
+		return string(data), true
+	}
+}
@@ -0,0 +1,147 @@
+package util_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gonginx/util"
+)
+
+func signJWT(t *testing.T, alg string, key any, claims map[string]any) string {
+	t.Helper()
+
+	enc := base64.RawURLEncoding
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := enc.EncodeToString(header) + "." + enc.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:])
+	case *ecdsa.PrivateKey:
+		r, s, _ := ecdsa.Sign(rand.Reader, k, sum[:])
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+
+	return signed + "." + enc.EncodeToString(sig)
+}
+
+func publicPEM(t *testing.T, pub any) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestParseJWT(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	rsaKeys, err := util.ParseJWTKeys(publicPEM(t, &rsaKey.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKeys, err := util.ParseJWTKeys(publicPEM(t, &ecKey.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	octKeys, err := util.ParseJWTKeys([]byte(`{"keys":[{"kty":"oct","k":"` +
+		base64.RawURLEncoding.EncodeToString(secret) + `"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := map[string]any{"sub": "alice", "roles": []string{"a", "b"}}
+
+	tests := []struct {
+		name  string
+		token string
+		keys  []util.JWTKey
+		valid bool
+	}{
+		{name: "HS256", token: signJWT(t, "HS256", secret, claims), keys: octKeys, valid: true},
+		{name: "RS256", token: signJWT(t, "RS256", rsaKey, claims), keys: rsaKeys, valid: true},
+		{name: "ES256", token: signJWT(t, "ES256", ecKey, claims), keys: ecKeys, valid: true},
+		{name: "HS256 wrong secret", token: signJWT(t, "HS256", []byte("wrong"), claims), keys: octKeys},
+		{name: "RS256 by EC key", token: signJWT(t, "RS256", rsaKey, claims), keys: ecKeys},
+		{name: "malformed", token: "a.b", keys: octKeys},
+	}
+
+	for _, tt := range tests {
+		jwt, err := util.ParseJWT(tt.token, tt.keys)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid %v, got %v", tt.name, tt.valid, err)
+			continue
+		}
+
+		if jwt == nil {
+			continue
+		}
+
+		if sub, _ := jwt.Claim("sub"); sub != "alice" {
+			t.Errorf("%s: expected sub alice, got %q", tt.name, sub)
+		}
+
+		if roles, _ := jwt.Claim("roles"); roles != "a,b" {
+			t.Errorf("%s: expected roles a,b, got %q", tt.name, roles)
+		}
+	}
+}
+
+func TestJWTValidate(t *testing.T) {
+	secret := []byte("secret")
+	keys := []util.JWTKey{{Secret: secret}}
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		claims   map[string]any
+		iss, aud string
+		valid    bool
+	}{
+		{claims: map[string]any{"exp": now.Unix() + 60}, valid: true},
+		{claims: map[string]any{"exp": now.Unix() - 60}},
+		{claims: map[string]any{"nbf": now.Unix() + 60}},
+		{claims: map[string]any{"iss": "sso"}, iss: "sso", valid: true},
+		{claims: map[string]any{"iss": "evil"}, iss: "sso"},
+		{claims: map[string]any{"aud": []string{"web", "api"}}, aud: "api", valid: true},
+		{claims: map[string]any{"aud": "web"}, aud: "api"},
+	}
+
+	for _, tt := range tests {
+		jwt, err := util.ParseJWT(signJWT(t, "HS256", secret, tt.claims), keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := jwt.Validate(now, tt.iss, tt.aud); (err == nil) != tt.valid {
+			t.Errorf("%v: expected valid %v, got %v", tt.claims, tt.valid, err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package util
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"runtime"
+	"sync"
+	"unsafe"
+
+	"go.elara.ws/pcre/lib"
+	"modernc.org/libc"
+)
+
+// sizeT is the size of size_t of the platform.
+const sizeT = int(unsafe.Sizeof(lib.Tsize_t(0)))
+
+// PCRE is the regex compiled by PCRE2 like nginx, with the backreferences like \1 and the lookarounds like (?!...),
+// which are not supported by the regexp package. Unlike go.elara.ws/pcre, the empty matches like ^ are found,
+// and the empty subjects are matched. It is safe for the concurrent use, and freed by Close, or by its finalizer.
+type PCRE struct {
+	// Names are the names of the captures by their indexes, empty for the unnamed ones.
+	Names []string
+
+	expr string
+
+	lock sync.Mutex
+	tls  *libc.TLS
+	code uintptr
+	// data is the match data, reused by the matches under the lock.
+	data uintptr
+}
+
+// pcreNamedCapture finds the named captures like (?<name>...), (?'name'...) or (?P<name>...) in the regex.
+var pcreNamedCapture = regexp.MustCompile(`\(\?(?:P?<([A-Za-z_]\w*)>|'([A-Za-z_]\w*)')`)
+
+// CompilePCRE compiles the regex by PCRE2.
+func CompilePCRE(expr string) (*PCRE, error) {
+	tls := libc.NewTLS()
+
+	pattern, err := libc.CString(expr)
+	if err != nil {
+		tls.Close()
+		return nil, err
+	}
+
+	defer libc.Xfree(tls, pattern)
+
+	// the outputs are in the C memory too, like all the memory the C code works with.
+	errCode := libc.Xmalloc(tls, 16)
+	defer libc.Xfree(tls, errCode)
+
+	code := lib.Xpcre2_compile_8(tls, pattern, lib.Tsize_t(len(expr)), 0, errCode, errCode+8, 0)
+	if code == 0 {
+		msg := pcreMessage(tls, int32(binary.NativeEndian.Uint32(libc.GoBytes(errCode, 4))))
+		offset := readSizeT(libc.GoBytes(errCode+8, sizeT))
+		tls.Close()
+
+		return nil, fmt.Errorf("%s at offset %d", msg, offset)
+	}
+
+	p := &PCRE{expr: expr, tls: tls, code: code, data: lib.Xpcre2_match_data_create_from_pattern_8(tls, code, 0)}
+	runtime.SetFinalizer(p, (*PCRE).Close)
+
+	lib.Xpcre2_pattern_info_8(tls, code, lib.DPCRE2_INFO_CAPTURECOUNT, errCode)
+	p.Names = make([]string, binary.NativeEndian.Uint32(libc.GoBytes(errCode, 4))+1)
+
+	for _, m := range pcreNamedCapture.FindAllStringSubmatch(expr, -1) {
+		if i := p.number(m[1] + m[2]); i > 0 && i < len(p.Names) {
+			p.Names[i] = m[1] + m[2]
+		}
+	}
+
+	return p, nil
+}
+
+func (p *PCRE) number(name string) int {
+	cName, err := libc.CString(name)
+	if err != nil {
+		return -1
+	}
+
+	defer libc.Xfree(p.tls, cName)
+
+	return int(lib.Xpcre2_substring_number_from_name_8(p.tls, p.code, cName))
+}
+
+// String returns the source text of the regex.
+func (p *PCRE) String() string { return p.expr }
+
+// MatchString tells whether the regex matches s.
+func (p *PCRE) MatchString(s string) bool {
+	return p.FindStringSubmatch(s) != nil
+}
+
+// FindStringSubmatch returns the leftmost match of the regex in s, and the captures,
+// the unset captures are empty. It returns nil if not matched.
+func (p *PCRE) FindStringSubmatch(s string) []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.code == 0 {
+		return nil
+	}
+
+	// the subject is copied out of the Go memory, which the C code is not allowed to walk through.
+	subject, err := libc.CString(s)
+	if err != nil {
+		return nil
+	}
+
+	defer libc.Xfree(p.tls, subject)
+
+	rc := lib.Xpcre2_match_8(p.tls, p.code, subject, lib.Tsize_t(len(s)), 0, 0, p.data, 0)
+	if rc < 0 {
+		if rc != lib.DPCRE2_ERROR_NOMATCH {
+			Warnf("regex %q failed to match: %s", p.expr, pcreMessage(p.tls, rc))
+		}
+
+		return nil
+	}
+
+	// the pairs of the start and end offsets, the unset ones are ~0.
+	pairs := int(lib.Xpcre2_get_ovector_count_8(p.tls, p.data))
+	ovector := libc.GoBytes(lib.Xpcre2_get_ovector_pointer_8(p.tls, p.data), 2*sizeT*pairs)
+	matches := make([]string, len(p.Names))
+
+	for i := 0; i < len(matches) && i < pairs; i++ {
+		start := readSizeT(ovector[2*sizeT*i:])
+		if end := readSizeT(ovector[2*sizeT*i+sizeT:]); start != uint64(^lib.Tsize_t(0)) {
+			matches[i] = s[start:end]
+		}
+	}
+
+	return matches
+}
+
+// Close frees the regex, which matches nothing after.
+func (p *PCRE) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.code == 0 {
+		return nil
+	}
+
+	lib.Xpcre2_match_data_free_8(p.tls, p.data)
+	lib.Xpcre2_code_free_8(p.tls, p.code)
+	p.tls.Close()
+	p.code, p.data = 0, 0
+
+	return nil
+}
+
+func pcreMessage(tls *libc.TLS, code int32) string {
+	buf := libc.Xmalloc(tls, 256)
+	defer libc.Xfree(tls, buf)
+
+	if lib.Xpcre2_get_error_message_8(tls, code, buf, 256) > 0 {
+		return libc.GoString(buf)
+	}
+
+	return fmt.Sprintf("error %d", code)
+}
+
+func readSizeT(b []byte) uint64 {
+	if sizeT == 4 {
+		return uint64(binary.NativeEndian.Uint32(b))
+	}
+
+	return binary.NativeEndian.Uint64(b)
+}
@@ -0,0 +1,44 @@
+package util_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/bingoohuang/gonginx/util"
+)
+
+func TestPCRE(t *testing.T) {
+	tests := []struct {
+		expr, subject string
+		matches       []string
+	}{
+		{expr: `^`, subject: "/loop", matches: []string{""}},
+		{expr: `^$`, subject: "", matches: []string{""}},
+		{expr: `x*`, subject: "abc", matches: []string{""}},
+		{expr: `^(a)?(b)?(c)?$`, subject: "b", matches: []string{"b", "", "b", ""}},
+		{expr: `(?i)^/API/(?<v>v\d)`, subject: "/api/v2/x", matches: []string{"/api/v2", "v2"}},
+		{expr: `^/(\w+)-\1$`, subject: "/ab-ab", matches: []string{"/ab-ab", "ab"}},
+		{expr: `^/(?!admin)`, subject: "/admin"},
+	}
+
+	for _, tt := range tests {
+		p, err := util.CompilePCRE(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.expr, err)
+		}
+
+		if got := p.FindStringSubmatch(tt.subject); !slices.Equal(got, tt.matches) || (got == nil) != (tt.matches == nil) {
+			t.Errorf("%s: expected %q of %q, got %q", tt.expr, tt.matches, tt.subject, got)
+		}
+
+		_ = p.Close()
+
+		if p.MatchString(tt.subject) {
+			t.Errorf("%s: expected no match after Close", tt.expr)
+		}
+	}
+
+	if _, err := util.CompilePCRE(`(`); err == nil {
+		t.Error("expected error of the invalid regex")
+	}
+}
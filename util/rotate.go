@@ -0,0 +1,269 @@
+package util
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotateOption defines the built-in rotation of the log file,
+// like access_log ... rotate=100m keep=7 compress.
+type RotateOption struct {
+	// MaxSize rotates the file when its size would exceed, 0 for no size-based rotation.
+	MaxSize int64
+	// Interval rotates the file hourly or daily, empty for no time-based rotation.
+	Interval string
+	// Keep is the number of the rotated files to keep, like a.log.1 ... a.log.7.
+	Keep int
+	// Compress gzips the rotated files.
+	Compress bool
+}
+
+// DefaultRotateKeep is the number of rotated files kept when keep= is absent.
+const DefaultRotateKeep = 7
+
+// ParseRotateParam parses the rotation parameter, rotate=100m, rotate=daily, keep=7 or compress,
+// and returns false if the parameter is not about rotation.
+func (o *RotateOption) ParseRotateParam(p string) (bool, error) {
+	switch {
+	case strings.HasPrefix(p, "rotate="):
+		v := strings.TrimPrefix(p, "rotate=")
+		switch v {
+		case "hourly", "daily":
+			o.Interval = v
+		default:
+			size, err := ParseSize(v)
+			if err != nil || size <= 0 {
+				return true, fmt.Errorf("invalid rotate=%s, expected size like 100m, hourly or daily", v)
+			}
+			o.MaxSize = size
+		}
+	case strings.HasPrefix(p, "keep="):
+		n, err := strconv.Atoi(strings.TrimPrefix(p, "keep="))
+		if err != nil || n <= 0 {
+			return true, fmt.Errorf("invalid %s", p)
+		}
+		o.Keep = n
+	case p == "compress":
+		o.Compress = true
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Enabled tells whether the rotation is configured.
+func (o RotateOption) Enabled() bool { return o.MaxSize > 0 || o.Interval != "" }
+
+// RotateFile is a log file which can be reopened (for logrotate) or rotated by itself.
+type RotateFile struct {
+	Path   string
+	Option RotateOption
+
+	lock     sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	// compressing waits for the rotated file compressed in the background.
+	compressing sync.WaitGroup
+}
+
+// OpenRotateFile opens the file for appending, creating the parent directories if necessary.
+func OpenRotateFile(path string, option RotateOption) (*RotateFile, error) {
+	if option.Keep <= 0 {
+		option.Keep = DefaultRotateKeep
+	}
+
+	f := &RotateFile{Path: path, Option: option}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *RotateFile) open() error {
+	if dir := filepath.Dir(f.Path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	f.file = file
+	f.size = 0
+	f.openedAt = time.Now()
+
+	if stat, err := file.Stat(); err == nil {
+		f.size = stat.Size()
+		if f.size > 0 {
+			f.openedAt = stat.ModTime()
+		}
+	}
+
+	return nil
+}
+
+// Write writes p into the file, rotating it before if necessary.
+func (f *RotateFile) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if f.needRotate(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+
+	return n, err
+}
+
+func (f *RotateFile) needRotate(n int64) bool {
+	if f.size == 0 {
+		return false
+	}
+
+	if f.Option.MaxSize > 0 && f.size+n > f.Option.MaxSize {
+		return true
+	}
+
+	return intervalElapsed(f.Option.Interval, f.openedAt, time.Now())
+}
+
+// intervalElapsed tells whether the hour or the day of the opened time, in the local wall-clock time, is over.
+func intervalElapsed(interval string, openedAt, now time.Time) bool {
+	y1, m1, d1 := now.Date()
+	y2, m2, d2 := openedAt.In(now.Location()).Date()
+	sameDay := y1 == y2 && m1 == m2 && d1 == d2
+
+	switch interval {
+	case "hourly":
+		return !sameDay || now.Hour() != openedAt.In(now.Location()).Hour()
+	case "daily":
+		return !sameDay
+	}
+
+	return false
+}
+
+// rotate renames a.log to a.log.1, a.log.1 to a.log.2 and so on, removing the ones beyond keep.
+// The rotated file is compressed in the background, which is waited by the next rotation.
+func (f *RotateFile) rotate() error {
+	f.compressing.Wait()
+
+	_ = f.file.Close()
+	f.file = nil
+
+	ext := ""
+	if f.Option.Compress {
+		ext = ".gz"
+	}
+
+	_ = os.Remove(fmt.Sprintf("%s.%d%s", f.Path, f.Option.Keep, ext))
+
+	for i := f.Option.Keep - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d%s", f.Path, i, ext), fmt.Sprintf("%s.%d%s", f.Path, i+1, ext))
+	}
+
+	rotated := f.Path + ".1"
+	if err := os.Rename(f.Path, rotated); err != nil {
+		return err
+	}
+
+	if f.Option.Compress {
+		f.compressing.Add(1)
+
+		go func() {
+			err := gzipFile(rotated)
+			// done ahead of logging, which may write to this file, waiting for the compression under the lock.
+			f.compressing.Done()
+
+			if err != nil {
+				Errorf("compress rotated log %s error: %v", rotated, err)
+			}
+		}()
+	}
+
+	return f.open()
+}
+
+func gzipFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+
+	defer src.Close()
+
+	dst, err := os.Create(name + ".gz")
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		_ = dst.Close()
+		return err
+	}
+
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(name)
+}
+
+// Reopen closes and opens the file again, e.g. after it is moved by logrotate.
+func (f *RotateFile) Reopen() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.file != nil {
+		_ = f.file.Close()
+		f.file = nil
+	}
+
+	return f.open()
+}
+
+// Close closes the file, after the rotated file compressed.
+func (f *RotateFile) Close() error {
+	f.compressing.Wait()
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+
+	return err
+}
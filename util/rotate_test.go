@@ -0,0 +1,123 @@
+package util_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gonginx/util"
+)
+
+func TestRotateFileBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	f, err := util.OpenRotateFile(path, util.RotateOption{MaxSize: 10, Keep: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"line 1\n", "line 2\n", "line 3\n", "line 4\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the rotated files are compressed in the background, waited by Close.
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, _ := os.ReadFile(path); string(b) != "line 4\n" {
+		t.Errorf("unexpected current file %q", b)
+	}
+
+	for _, name := range []string{path + ".1.gz", path + ".2.gz"} {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("expected rotated file %s: %v", name, err)
+		}
+	}
+
+	if _, err := os.Stat(path + ".3.gz"); err == nil {
+		t.Error("expected at most 2 rotated files")
+	}
+}
+
+func TestRotateFileReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	f, err := util.OpenRotateFile(path, util.RotateOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	_, _ = f.Write([]byte("before\n"))
+
+	// like logrotate, which moves the file and then sends USR1.
+	if err := os.Rename(path, path+".moved"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = f.Write([]byte("after\n"))
+
+	if b, _ := os.ReadFile(path + ".moved"); string(b) != "before\n" {
+		t.Errorf("unexpected moved file %q", b)
+	}
+
+	if b, _ := os.ReadFile(path); string(b) != "after\n" {
+		t.Errorf("unexpected reopened file %q", b)
+	}
+}
+
+func TestParseRotateParam(t *testing.T) {
+	var o util.RotateOption
+
+	for _, p := range []string{"rotate=100m", "keep=3", "compress"} {
+		if ok, err := o.ParseRotateParam(p); !ok || err != nil {
+			t.Errorf("ParseRotateParam(%q) = %v, %v", p, ok, err)
+		}
+	}
+
+	if o != (util.RotateOption{MaxSize: 100 << 20, Keep: 3, Compress: true}) {
+		t.Errorf("unexpected option %+v", o)
+	}
+
+	if ok, _ := o.ParseRotateParam("buffer=32k"); ok {
+		t.Error("buffer= is not a rotation parameter")
+	}
+
+	if _, err := o.ParseRotateParam("rotate=weekly"); err == nil {
+		t.Error("expected error for rotate=weekly")
+	}
+}
+
+func TestRotateIntervalElapsed(t *testing.T) {
+	// the half-hour offset, where the hours truncated in UTC are at :30 of the local time.
+	ist := time.FixedZone("IST", 5*3600+1800)
+	at := func(day, hour, minute int) time.Time { return time.Date(2024, 1, day, hour, minute, 0, 0, ist) }
+
+	tests := []struct {
+		interval       string
+		openedAt, now  time.Time
+		expectedRotate bool
+	}{
+		{interval: "hourly", openedAt: at(1, 10, 10), now: at(1, 10, 40)},
+		{interval: "hourly", openedAt: at(1, 10, 10), now: at(1, 11, 5), expectedRotate: true},
+		{interval: "hourly", openedAt: at(1, 23, 50), now: at(2, 0, 10), expectedRotate: true},
+		{interval: "daily", openedAt: at(1, 0, 10), now: at(1, 23, 50)},
+		{interval: "daily", openedAt: at(1, 23, 50), now: at(2, 0, 10), expectedRotate: true},
+		{interval: "", openedAt: at(1, 0, 10), now: at(3, 0, 10)},
+	}
+
+	for _, tt := range tests {
+		if got := util.IntervalElapsed(tt.interval, tt.openedAt, tt.now); got != tt.expectedRotate {
+			t.Errorf("%s %s -> %s: expected %v, got %v", tt.interval, tt.openedAt, tt.now, tt.expectedRotate, got)
+		}
+	}
+}
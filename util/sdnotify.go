@@ -0,0 +1,31 @@
+package util
+
+import (
+	"net"
+	"os"
+)
+
+// SdNotify sends the state, like READY=1, to the systemd notify socket.
+// It does nothing when NOTIFY_SOCKET is not set, that is, not started by systemd with Type=notify.
+// https://www.freedesktop.org/software/systemd/man/sd_notify.html
+func SdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	// abstract namespace socket
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
@@ -0,0 +1,43 @@
+package util_test
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/bingoohuang/gonginx/util"
+)
+
+func TestSdNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+
+	if err := util.SdNotify("READY=1"); err != nil {
+		t.Fatalf("expected no-op without NOTIFY_SOCKET, got %v", err)
+	}
+
+	socket := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", socket)
+
+	for _, state := range []string{"READY=1", "RELOADING=1", "STOPPING=1"} {
+		if err := util.SdNotify(state); err != nil {
+			t.Fatal(err)
+		}
+
+		buf := make([]byte, 64)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(buf[:n]) != state {
+			t.Errorf("expected %q, got %q", state, buf[:n])
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package util_test
+
+import (
+	"testing"
+
+	"github.com/bingoohuang/gonginx/util"
+)
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{
+		"1024": 1024,
+		"8k":   8 << 10,
+		"100m": 100 << 20,
+		"1G":   1 << 30,
+	}
+
+	for s, expected := range cases {
+		if n, err := util.ParseSize(s); err != nil || n != expected {
+			t.Errorf("ParseSize(%q) = %v, %v, expected %v", s, n, err, expected)
+		}
+	}
+
+	for _, s := range []string{"", "k", "-1", "1x"} {
+		if _, err := util.ParseSize(s); err == nil {
+			t.Errorf("ParseSize(%q) expected error", s)
+		}
+	}
+}
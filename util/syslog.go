@@ -0,0 +1,236 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11, "ntp": 12, "audit": 13, "alert": 14, "clock": 15,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// Syslog sends the messages to the syslog server.
+// http://nginx.org/en/docs/syslog.html
+type Syslog struct {
+	// Network is udp, tcp, unixgram or unix.
+	Network string
+	Addr    string
+
+	Facility int
+	// Severity is the severity of the messages written by Write.
+	Severity Level
+	Tag      string
+	// NoHostname omits the hostname in the header.
+	NoHostname bool
+	// RFC5424 uses the RFC 5424 header instead of the RFC 3164 (BSD) one.
+	RFC5424 bool
+
+	hostname string
+
+	lock sync.Mutex
+	conn net.Conn
+}
+
+// OpenSyslog opens the syslog by the nginx syslog parameters,
+// like server=unix:/dev/log,facility=local7,tag=nginx,severity=info.
+// Besides nginx, the server can be tcp://host:port or udp://host:port,
+// and rfc=5424 uses the RFC 5424 header.
+func OpenSyslog(params string) (*Syslog, error) {
+	s := &Syslog{Facility: syslogFacilities["local7"], Severity: LevelInfo, Tag: "gonginx"}
+
+	for _, p := range strings.Split(params, ",") {
+		kv := strings.SplitN(p, "=", 2)
+		if kv[0] == "nohostname" {
+			s.NoHostname = true
+			continue
+		}
+
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid syslog parameter %q", p)
+		}
+
+		switch k, v := kv[0], kv[1]; k {
+		case "server":
+			s.Network, s.Addr = parseSyslogServer(v)
+		case "facility":
+			f, ok := syslogFacilities[v]
+			if !ok {
+				return nil, fmt.Errorf("unknown syslog facility %q", v)
+			}
+			s.Facility = f
+		case "severity":
+			l, ok := ParseLevel(v)
+			if !ok {
+				return nil, fmt.Errorf("unknown syslog severity %q", v)
+			}
+			s.Severity = l
+		case "tag":
+			s.Tag = v
+		case "rfc":
+			if v != "3164" && v != "5424" {
+				return nil, fmt.Errorf("unknown syslog rfc %q, expected 3164 or 5424", v)
+			}
+			s.RFC5424 = v == "5424"
+		default:
+			return nil, fmt.Errorf("unknown syslog parameter %q", p)
+		}
+	}
+
+	if s.Addr == "" {
+		return nil, fmt.Errorf("no syslog server specified in %q", params)
+	}
+
+	s.hostname, _ = os.Hostname()
+
+	if err := s.Reopen(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// parseSyslogServer parses the server address, the default port of udp/tcp is 514.
+func parseSyslogServer(v string) (network, addr string) {
+	switch {
+	case strings.HasPrefix(v, "unix:"):
+		return "unixgram", strings.TrimPrefix(v, "unix:")
+	case strings.HasPrefix(v, "tcp://"):
+		network, addr = "tcp", strings.TrimPrefix(v, "tcp://")
+	default:
+		network, addr = "udp", strings.TrimPrefix(v, "udp://")
+	}
+
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), "514")
+	}
+
+	return network, addr
+}
+
+// Reopen reconnects to the syslog server.
+func (s *Syslog) Reopen() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.dial()
+}
+
+func (s *Syslog) dial() error {
+	if s.conn != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+
+	conn, err := net.DialTimeout(s.Network, s.Addr, 5*time.Second)
+	if err != nil && s.Network == "unixgram" {
+		// the unix socket may be a stream one, like the syslog-ng one.
+		if conn, err = net.DialTimeout("unix", s.Addr, 5*time.Second); err == nil {
+			s.Network = "unix"
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("connect syslog %s %s: %w", s.Network, s.Addr, err)
+	}
+
+	s.conn = conn
+
+	return nil
+}
+
+// Write sends each line of p as a message with the Severity.
+func (s *Syslog) Write(p []byte) (int, error) {
+	for _, line := range bytes.Split(p, []byte("\n")) {
+		if len(line) > 0 {
+			if err := s.WriteLevel(s.Severity, string(line)); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return len(p), nil
+}
+
+// WriteLevel sends the message with the severity of the level,
+// and reconnects once when the sending fails, e.g. the syslog daemon restarted.
+func (s *Syslog) WriteLevel(level Level, msg string) error {
+	msg = strings.TrimRight(msg, "\n")
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.conn != nil {
+		if _, err := s.conn.Write(s.format(level, msg)); err == nil {
+			return nil
+		}
+	}
+
+	if err := s.dial(); err != nil {
+		return err
+	}
+
+	_, err := s.conn.Write(s.format(level, msg))
+
+	return err
+}
+
+// Close closes the connection to the syslog server.
+func (s *Syslog) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	s.conn = nil
+
+	return err
+}
+
+// format formats the message with the header, the messages over the stream sockets are framed
+// by the octet counting for RFC 5424, and by the trailing LF for RFC 3164 (RFC 6587).
+func (s *Syslog) format(level Level, msg string) []byte {
+	// the syslog severities are from emerg 0 to debug 7, in reverse order of the levels.
+	pri := s.Facility*8 + int(LevelEmerg-level)
+	now := time.Now()
+
+	var b bytes.Buffer
+
+	if s.RFC5424 {
+		hostname := s.hostname
+		if s.NoHostname || hostname == "" {
+			hostname = "-"
+		}
+
+		fmt.Fprintf(&b, "<%d>1 %s %s %s %d - - %s", pri, now.Format("2006-01-02T15:04:05.000000Z07:00"),
+			hostname, s.Tag, os.Getpid(), msg)
+	} else {
+		fmt.Fprintf(&b, "<%d>%s ", pri, now.Format(time.Stamp))
+		if !s.NoHostname && s.hostname != "" {
+			b.WriteString(s.hostname + " ")
+		}
+
+		fmt.Fprintf(&b, "%s: %s", s.Tag, msg)
+	}
+
+	if s.Network == "tcp" || s.Network == "unix" {
+		if s.RFC5424 {
+			return append([]byte(strconv.Itoa(b.Len())+" "), b.Bytes()...)
+		}
+
+		b.WriteByte('\n')
+	}
+
+	return b.Bytes()
+}
@@ -0,0 +1,126 @@
+package util_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/gonginx/util"
+)
+
+func TestSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	s, err := util.OpenSyslog("server=" + pc.LocalAddr().String() + ",facility=local7,tag=gonginx,severity=info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err := s.Write([]byte("line 1\nline 2\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// local7(23) * 8 + info(6) = 190
+	re := regexp.MustCompile(`^<190>\w{3} [ \d]\d \d\d:\d\d:\d\d (\S+ )?gonginx: line \d$`)
+
+	for _, want := range []string{"line 1", "line 2"} {
+		if msg := readPacket(t, pc); !re.MatchString(msg) || !strings.HasSuffix(msg, want) {
+			t.Errorf("unexpected message %q", msg)
+		}
+	}
+}
+
+func TestSyslogTCP5424(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s, err := util.OpenSyslog("server=tcp://" + l.Addr().String() + ",facility=user,tag=app,rfc=5424,nohostname")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	el := util.ErrorLog{Outputs: []util.ErrorOutput{{Level: util.LevelWarn, Writer: s}}}
+	el.Errorf("upstream %s failed", "a")
+
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	r := bufio.NewReader(conn)
+
+	size, err := r.ReadString(' ')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(size))
+	if err != nil {
+		t.Fatalf("invalid octet counting %q", size)
+	}
+
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// user(1) * 8 + err(3) = 11
+	re := regexp.MustCompile(`^<11>1 \S+ - app \d+ - - \d{4}/\d\d/\d\d \d\d:\d\d:\d\d \[error\] \d+#0: upstream a failed$`)
+
+	if !re.Match(msg) {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
+
+func TestSyslogUnix(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "log.sock")
+
+	pc, err := net.ListenPacket("unixgram", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	s, err := util.OpenSyslog("server=unix:" + addr + ",severity=warn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	_, _ = s.Write([]byte("hello"))
+
+	// local7(23) * 8 + warning(4) = 188
+	if msg := readPacket(t, pc); !strings.HasPrefix(msg, "<188>") || !strings.HasSuffix(msg, " gonginx: hello") {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
+
+func readPacket(t *testing.T, pc net.PacketConn) string {
+	_ = pc.SetReadDeadline(time.Now().Add(3 * time.Second))
+
+	buf := make([]byte, 2048)
+
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(buf[:n])
+}